@@ -0,0 +1,366 @@
+// Command eval runs a directory of golden extraction cases through the
+// extraction pipeline for one or more models and prompt versions, applies the
+// returned selectors to the case HTML and reports accuracy, robustness,
+// latency and cost as JSON and Markdown.
+//
+// Each case is a directory containing a case.json file:
+//
+//	{
+//	  "description": "Product detail page",
+//	  "html": "page.html",
+//	  "fields": [{"name": "price", "type": "number", "additionalInfo": ""}],
+//	  "expected": {"price": "19.99"}
+//	}
+//
+// Usage:
+//
+//	go run ./cmd/eval -cases eval/cases -models x-ai/grok-3-mini,google/gemini-2.5-flash -out eval/reports
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/selectors"
+	"selectorextractor_backend/pkg/extractor"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+type evalCase struct {
+	Name        string                          `json:"-"`
+	Description string                          `json:"description"`
+	HTMLFile    string                          `json:"html"`
+	Fields      []ai.FieldToExtractSelectorsFor `json:"fields"`
+	// Expected holds the value of each scored field; the values of
+	// multi-valued fields go on separate lines and object and array fields
+	// hold the expected record as JSON.
+	Expected map[string]string `json:"expected"`
+
+	html string
+}
+
+func main() {
+	casesDir := flag.String("cases", "eval/cases", "directory containing one sub-directory per case")
+	models := flag.String("models", "", "comma-separated models to evaluate (default: DEFAULT_MODEL)")
+	promptVersions := flag.String("prompt-versions", "", "comma-separated prompt versions to evaluate (default: PROMPT_VERSION or "+ai.DefaultPromptVersion+")")
+	outDir := flag.String("out", "eval/reports", "directory the JSON and Markdown reports are written to")
+	baseline := flag.String("baseline", "", "previous report.json to compare against")
+	flag.Parse()
+
+	godotenv.Load()
+	cfg := config.Load()
+	cfg.Log.Dir = ""
+	if err := logging.Init(cfg.Log); err != nil {
+		logging.Fatal("Failed to initialize logger", "error", err)
+	}
+
+	provider, err := ai.NewProvider(cfg.AI)
+	if err != nil {
+		logging.Fatal("Failed to initialize AI provider", "error", err)
+	}
+	if provider.RequiresAPIKey() && len(cfg.AI.OpenRouterAPIKeys) == 0 {
+		logging.Fatal("OPENROUTER_API_KEY or OPENROUTER_API_KEYS must be set")
+	}
+	ext, err := extractor.New(
+		extractor.WithConfig(cfg.AI),
+		extractor.WithProvider(provider),
+		extractor.WithKeys(ai.NewKeyPool(cfg.AI.OpenRouterAPIKeys, cfg.AI.KeyCooldown)),
+	)
+	if err != nil {
+		logging.Fatal("Failed to initialize extractor", "error", err)
+	}
+
+	modelList := splitList(*models, cfg.AI.DefaultModel)
+	versionList := splitList(*promptVersions, cfg.AI.PromptVersion)
+	if len(versionList) == 0 {
+		versionList = []string{ai.DefaultPromptVersion}
+	}
+	for _, version := range versionList {
+		if !ai.IsPromptVersion(version) {
+			logging.Fatal("Unknown prompt version", "version", version, "available", ai.PromptVersions())
+		}
+	}
+
+	cases, err := loadCases(*casesDir)
+	if err != nil {
+		logging.Fatal("Failed to load cases", "error", err)
+	}
+	if len(cases) == 0 {
+		logging.Fatal("No cases found", "dir", *casesDir)
+	}
+
+	report := Report{StartedAt: time.Now().UTC()}
+	for _, model := range modelList {
+		for _, version := range versionList {
+			for _, c := range cases {
+				logging.Logger.Info("Evaluating case", "case", c.Name, "model", model, "prompt_version", version)
+				report.Cases = append(report.Cases, runCase(context.Background(), ext, c, model, version))
+			}
+		}
+	}
+	report.summarize()
+
+	if *baseline != "" {
+		previous, err := loadReport(*baseline)
+		if err != nil {
+			logging.Fatal("Failed to load baseline report", "error", err)
+		}
+		report.Baseline = previous
+	}
+
+	if err := report.write(*outDir); err != nil {
+		logging.Fatal("Failed to write report", "error", err)
+	}
+	fmt.Print(report.Markdown())
+}
+
+func splitList(value, fallback string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 && fallback != "" {
+		list = []string{fallback}
+	}
+	return list
+}
+
+func loadCases(dir string) ([]evalCase, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []evalCase
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		caseDir := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(caseDir, "case.json"))
+		if err != nil {
+			return nil, fmt.Errorf("case %s: %w", entry.Name(), err)
+		}
+
+		c := evalCase{Name: entry.Name(), HTMLFile: "page.html"}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("case %s: %w", entry.Name(), err)
+		}
+		html, err := os.ReadFile(filepath.Join(caseDir, c.HTMLFile))
+		if err != nil {
+			return nil, fmt.Errorf("case %s: %w", entry.Name(), err)
+		}
+		c.html = string(html)
+		cases = append(cases, c)
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+func runCase(ctx context.Context, ext *extractor.Extractor, c evalCase, model, promptVersion string) CaseResult {
+	result := CaseResult{
+		Case:          c.Name,
+		Model:         model,
+		PromptVersion: promptVersion,
+	}
+
+	request := ai.SendExtractionMessageRequest{
+		HTML:                        c.html,
+		FieldsToExtractSelectorsFor: c.Fields,
+		Model:                       model,
+		PromptVersion:               promptVersion,
+	}
+
+	start := time.Now()
+	response, err := ext.Extract(ctx, request)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Usage = response.Usage
+	result.CostUSD = response.TotalPrice
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	extracted := make(map[string]ai.ExtractedSelector, len(response.Fields))
+	for _, field := range response.Fields {
+		extracted[field.Field] = field
+	}
+
+	// Selectors are applied to the original HTML through the extractor's
+	// apply path, the same way a scraper using /apply reads them.
+	apply := extractor.ApplyRequest{HTML: c.html}
+	for _, want := range c.Fields {
+		if field, ok := extracted[want.Name]; ok {
+			apply.Fields = append(apply.Fields, extractor.ApplyField{Selector: field, Type: want.Type})
+		}
+	}
+	applied := make(map[string]extractor.Value, len(apply.Fields))
+	values, applyErr := ext.ApplyFields(ctx, apply)
+	for _, value := range values {
+		applied[value.Field] = value
+	}
+
+	for _, want := range c.Fields {
+		expected, scored := c.Expected[want.Name]
+		if !scored {
+			continue
+		}
+		fieldResult := FieldResult{Field: want.Name, Type: want.Type, Expected: expected}
+		field, ok := extracted[want.Name]
+		if !ok {
+			fieldResult.Error = "field missing from model response"
+			result.Fields = append(result.Fields, fieldResult)
+			continue
+		}
+		if applyErr != nil {
+			fieldResult.Error = applyErr.Error()
+			result.Fields = append(result.Fields, fieldResult)
+			continue
+		}
+
+		value := applied[want.Name]
+		// The selector scored is the rule the value was read with: the
+		// field's own or one of its fallbacks.
+		if alternatives := field.Alternatives(); field.Selector != "" && value.Fallback < len(alternatives) {
+			field = alternatives[value.Fallback]
+		}
+		fieldResult.Selector = field.Selector
+		fieldResult.Robustness = robustness(field)
+		fieldResult.Error = value.Error
+
+		switch {
+		case ai.IsRecord(want.Type):
+			actual, _ := json.Marshal(value.Value)
+			fieldResult.Actual = string(actual)
+			var want any
+			fieldResult.Correct = value.Error == "" && json.Unmarshal([]byte(expected), &want) == nil && matchesRecord(want, value.Value)
+		case field.Multiple:
+			items, _ := value.Value.([]any)
+			texts := make([]string, 0, len(items))
+			for _, item := range items {
+				texts = append(texts, leafText(item))
+			}
+			fieldResult.Actual = strings.Join(texts, "\n")
+			fieldResult.Correct = value.Error == "" && matchesAll(want.Type, strings.Split(expected, "\n"), texts)
+		default:
+			fieldResult.Actual = leafText(value.Value)
+			fieldResult.Correct = value.Error == "" && matches(want.Type, expected, fieldResult.Actual)
+		}
+		result.Fields = append(result.Fields, fieldResult)
+	}
+
+	return result
+}
+
+// matches compares an extracted value with the expected one, ignoring
+// whitespace differences and, for number fields, formatting, by parsing both
+// sides as the number converter does ("1.299,00" equals "1299").
+func matches(fieldType, expected, actual string) bool {
+	expected = strings.Join(strings.Fields(expected), " ")
+	actual = strings.Join(strings.Fields(actual), " ")
+	if expected == actual {
+		return true
+	}
+	if fieldType == selectors.TypeNumber {
+		expectedNumber, err1 := selectors.ParseNumber(expected)
+		actualNumber, err2 := selectors.ParseNumber(actual)
+		return err1 == nil && err2 == nil && expectedNumber == actualNumber
+	}
+	return false
+}
+
+// matchesAll compares the values of a multi-valued field with the expected
+// ones in order.
+func matchesAll(fieldType string, expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if !matches(fieldType, expected[i], actual[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesRecord compares a record read by ai.Evaluate with the expected one
+// decoded from JSON, comparing its values as matches does.
+func matchesRecord(expected, actual any) bool {
+	switch expected := expected.(type) {
+	case map[string]any:
+		actual, ok := actual.(map[string]any)
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for key, value := range expected {
+			if !matchesRecord(value, actual[key]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		actual, ok := actual.([]any)
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !matchesRecord(expected[i], actual[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return matches("", leafText(expected), leafText(actual))
+}
+
+func leafText(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// robustness scores how likely a field's extraction is to survive changes to
+// the page, from 0 to 1. Declarative selectors without positional
+// pseudo-classes or long combinator chains score highest; function-only
+// extraction scores lowest.
+func robustness(field ai.ExtractedSelector) float64 {
+	if field.Selector == "" {
+		return 0.25
+	}
+
+	score := 1.0
+	for _, positional := range []string{":nth-child", ":nth-of-type", ":nth-last-child", ":first-child", ":last-child"} {
+		if strings.Contains(field.Selector, positional) {
+			score -= 0.25
+			break
+		}
+	}
+	if steps := len(strings.Fields(strings.ReplaceAll(field.Selector, ">", " "))); steps > 4 {
+		score -= 0.25
+	}
+	if field.Regex != "" {
+		score -= 0.15
+	}
+	// Functions of JSON path rules are generated, not a sign of a fragile rule.
+	if field.JavaScriptFunction != "" && field.JSONPath == "" {
+		score -= 0.1
+	}
+	return max(score, 0)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"selectorextractor_backend/internal/ai"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Report struct {
+	StartedAt time.Time    `json:"startedAt"`
+	Runs      []RunSummary `json:"runs"`
+	Cases     []CaseResult `json:"cases"`
+	Baseline  *Report      `json:"-"`
+}
+
+// RunSummary aggregates all cases evaluated with one model and prompt version.
+type RunSummary struct {
+	Model         string             `json:"model"`
+	PromptVersion string             `json:"promptVersion"`
+	Cases         int                `json:"cases"`
+	FailedCases   int                `json:"failedCases"`
+	Fields        int                `json:"fields"`
+	CorrectFields int                `json:"correctFields"`
+	Accuracy      float64            `json:"accuracy"`
+	FieldAccuracy map[string]float64 `json:"fieldAccuracy"`
+	Robustness    float64            `json:"robustness"`
+	AvgLatencyMs  int64              `json:"avgLatencyMs"`
+	TotalCostUSD  float64            `json:"totalCostUsd"`
+}
+
+type CaseResult struct {
+	Case          string        `json:"case"`
+	Model         string        `json:"model"`
+	PromptVersion string        `json:"promptVersion"`
+	Error         string        `json:"error,omitempty"`
+	LatencyMs     int64         `json:"latencyMs"`
+	Usage         ai.TokenUsage `json:"usage"`
+	CostUSD       float64       `json:"costUsd"`
+	Fields        []FieldResult `json:"fields"`
+}
+
+type FieldResult struct {
+	Field      string  `json:"field"`
+	Type       string  `json:"type"`
+	Selector   string  `json:"selector,omitempty"`
+	Expected   string  `json:"expected"`
+	Actual     string  `json:"actual"`
+	Correct    bool    `json:"correct"`
+	Robustness float64 `json:"robustness"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func (r *Report) summarize() {
+	type key struct{ model, version string }
+	type fieldTally struct{ correct, total int }
+
+	summaries := make(map[key]*RunSummary)
+	fieldTallies := make(map[key]map[string]*fieldTally)
+	robustness := make(map[key]float64)
+	latency := make(map[key]int64)
+	var order []key
+
+	for _, c := range r.Cases {
+		k := key{c.Model, c.PromptVersion}
+		summary, ok := summaries[k]
+		if !ok {
+			summary = &RunSummary{Model: c.Model, PromptVersion: c.PromptVersion}
+			summaries[k] = summary
+			fieldTallies[k] = make(map[string]*fieldTally)
+			order = append(order, k)
+		}
+
+		summary.Cases++
+		if c.Error != "" {
+			summary.FailedCases++
+		}
+		summary.TotalCostUSD += c.CostUSD
+		latency[k] += c.LatencyMs
+
+		for _, f := range c.Fields {
+			summary.Fields++
+			robustness[k] += f.Robustness
+			tally, ok := fieldTallies[k][f.Field]
+			if !ok {
+				tally = &fieldTally{}
+				fieldTallies[k][f.Field] = tally
+			}
+			tally.total++
+			if f.Correct {
+				summary.CorrectFields++
+				tally.correct++
+			}
+		}
+	}
+
+	r.Runs = nil
+	for _, k := range order {
+		summary := summaries[k]
+		summary.AvgLatencyMs = latency[k] / int64(summary.Cases)
+		summary.FieldAccuracy = make(map[string]float64, len(fieldTallies[k]))
+		for name, tally := range fieldTallies[k] {
+			summary.FieldAccuracy[name] = float64(tally.correct) / float64(tally.total)
+		}
+		if summary.Fields > 0 {
+			summary.Accuracy = float64(summary.CorrectFields) / float64(summary.Fields)
+			summary.Robustness = robustness[k] / float64(summary.Fields)
+		}
+		r.Runs = append(r.Runs, *summary)
+	}
+}
+
+func (r *Report) write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := "report-" + r.StartedAt.Format("20060102-150405")
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".md"), []byte(r.Markdown()), 0644)
+}
+
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Markdown renders the run summaries, per-field accuracy and, when a baseline
+// is loaded, the change against it.
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Extraction evaluation %s\n\n", r.StartedAt.Format(time.RFC3339))
+
+	b.WriteString("| Model | Prompt | Cases | Failed | Accuracy | Robustness | Avg latency | Cost |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|\n")
+	for _, run := range r.Runs {
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %s | %.2f | %dms | $%.4f |\n",
+			run.Model, run.PromptVersion, run.Cases, run.FailedCases,
+			r.withDelta(run, run.Accuracy, func(s RunSummary) float64 { return s.Accuracy }),
+			run.Robustness, run.AvgLatencyMs, run.TotalCostUSD)
+	}
+
+	for _, run := range r.Runs {
+		fmt.Fprintf(&b, "\n## %s / %s\n\n", run.Model, run.PromptVersion)
+		b.WriteString("| Field | Accuracy |\n|---|---|\n")
+		names := make([]string, 0, len(run.FieldAccuracy))
+		for name := range run.FieldAccuracy {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "| %s | %.0f%% |\n", name, run.FieldAccuracy[name]*100)
+		}
+	}
+
+	var failures []string
+	for _, c := range r.Cases {
+		for _, f := range c.Fields {
+			if !f.Correct {
+				failures = append(failures, fmt.Sprintf("| %s | %s / %s | %s | %q | %q | %s |",
+					c.Case, c.Model, c.PromptVersion, f.Field, f.Expected, f.Actual, f.Error))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		b.WriteString("\n## Incorrect fields\n\n")
+		b.WriteString("| Case | Run | Field | Expected | Actual | Error |\n|---|---|---|---|---|---|\n")
+		b.WriteString(strings.Join(failures, "\n"))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func (r *Report) withDelta(run RunSummary, value float64, metric func(RunSummary) float64) string {
+	formatted := fmt.Sprintf("%.1f%%", value*100)
+	if r.Baseline == nil {
+		return formatted
+	}
+	for _, previous := range r.Baseline.Runs {
+		if previous.Model == run.Model && previous.PromptVersion == run.PromptVersion {
+			return fmt.Sprintf("%s (%+.1f)", formatted, (value-metric(previous))*100)
+		}
+	}
+	return formatted
+}
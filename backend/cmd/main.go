@@ -1,70 +1,172 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/auth"
 	"selectorextractor_backend/internal/config"
 	"selectorextractor_backend/internal/handlers"
 	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/metrics"
 	"selectorextractor_backend/internal/middleware"
+	"selectorextractor_backend/internal/quota"
+	"selectorextractor_backend/internal/tracing"
+	"selectorextractor_backend/pkg/extractor"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
+	// Load environment variables
+	envErr := godotenv.Load()
+
+	// Load configuration
+	cfg := config.Load()
+
 	// Initialize logging
-	if err := logging.InitLoggers(); err != nil {
-		log.Fatalf("Failed to initialize loggers: %v", err)
+	if err := logging.Init(cfg.Log); err != nil {
+		logging.Fatal("Failed to initialize logger", "error", err)
+	}
+	if envErr != nil {
+		logging.Logger.Warn("Error loading .env file", "error", envErr)
 	}
 
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		logging.ErrorLogger.Printf("Error loading .env file: %v", err)
+	if cfg.AI.PromptVersion != "" && !ai.IsPromptVersion(cfg.AI.PromptVersion) {
+		logging.Fatal("Unknown PROMPT_VERSION", "version", cfg.AI.PromptVersion, "available", ai.PromptVersions())
 	}
 
-	// Load configuration
-	cfg := config.Load()
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logging.Logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
 
 	// Initialize Echo
 	e := echo.New()
+	ipExtractor, err := middleware.IPExtractor(cfg.Server.TrustedProxies)
+	if err != nil {
+		logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+	}
+	e.IPExtractor = ipExtractor
 
 	// Initialize middleware
-	m := middleware.New(cfg.Security.RateLimit.Limit)
+	m := middleware.New(cfg.Security.RateLimit)
 
 	// Apply middleware
+	e.Use(m.RequestID())
+	e.Use(m.Trace())
+	e.Use(m.Metrics())
 	e.Use(m.RequestLogger())
 	e.Use(m.Recover())
-	e.Use(m.Timeout(cfg.Server.WriteTimeout))
 	e.Use(m.CORS(cfg.Security.AllowedOrigins))
 
+	provider, err := ai.NewProvider(cfg.AI)
+	if err != nil {
+		logging.Fatal("Failed to initialize AI provider", "error", err)
+	}
+
+	// In server auth mode provider keys stay on the server and clients
+	// authenticate with their own tokens.
+	var keys *ai.KeyPool
+	var protected []echo.MiddlewareFunc
+	switch cfg.Security.Auth.Mode {
+	case config.AuthModeServer:
+		if provider.RequiresAPIKey() && len(cfg.AI.OpenRouterAPIKeys) == 0 {
+			logging.Fatal("Server auth mode requires OPENROUTER_API_KEYS")
+		}
+		authenticator, err := auth.NewAuthenticator(cfg.Security.Auth)
+		if err != nil {
+			logging.Fatal("Failed to initialize authenticator", "error", err)
+		}
+		keys = ai.NewKeyPool(cfg.AI.OpenRouterAPIKeys, cfg.AI.KeyCooldown)
+		protected = append(protected, m.Authenticate(authenticator))
+	case config.AuthModeClientKey:
+	default:
+		logging.Fatal("Unknown AUTH_MODE", "mode", cfg.Security.Auth.Mode)
+	}
+
+	// The rate limit runs after authentication, so that server mode limits
+	// are keyed on the verified client rather than on unchecked headers.
+	var limited []echo.MiddlewareFunc
 	if cfg.Security.RateLimit.Enabled {
-		e.Use(m.RateLimit())
+		limited = append(limited, m.RateLimit())
+	}
+	protected = append(protected, limited...)
+
+	ext, err := extractor.New(
+		extractor.WithConfig(cfg.AI),
+		extractor.WithProvider(provider),
+		extractor.WithFetchConfig(cfg.Fetch),
+	)
+	if err != nil {
+		logging.Fatal("Failed to initialize extractor", "error", err)
 	}
 
+	h := handlers.New(ext, keys, quota.NewTracker())
+
+	e.GET("/metrics", metrics.Handler())
+
+	// Batch extraction makes several extractions in a row and gets its own,
+	// longer timeout.
+	timeout := m.Timeout(cfg.Server.WriteTimeout)
+	public := append([]echo.MiddlewareFunc{timeout}, limited...)
+	batch := append([]echo.MiddlewareFunc{m.Timeout(cfg.Server.BatchTimeout)}, protected...)
+	protected = append([]echo.MiddlewareFunc{timeout}, protected...)
+
 	// API v1 routes
 	v1 := e.Group("/api/v1")
 	{
-		v1.GET("/health", handlers.HandleHealthCheck)
-		v1.POST("/extract", func(c echo.Context) error {
-			logging.InfoLogger.Println("Received extraction request")
-			return handlers.HandleExtractionRequest(c, cfg.AI)
-		})
+		v1.GET("/health", handlers.HandleHealthCheck, public...)
+		v1.POST("/extract", h.HandleExtractionRequest, protected...)
+		v1.POST("/estimate", h.HandleEstimateRequest, protected...)
+		v1.POST("/apply", h.HandleApplyRequest, protected...)
+		v1.POST("/batch/extract", h.HandleBatchExtractRequest, batch...)
+		v1.POST("/batch/apply", h.HandleBatchApplyRequest, protected...)
+		v1.POST("/archive/entries", h.HandleArchiveEntriesRequest, protected...)
 	}
 
 	// Start server
 	addr := fmt.Sprintf(":%s", cfg.Server.Port)
-	logging.InfoLogger.Printf("Server starting on port %s", cfg.Server.Port)
+	logging.Logger.Info("Server starting", "port", cfg.Server.Port)
 
+	// The routes enforce their own timeouts; the connection's write timeout
+	// only has to outlast the longest of them.
 	s := &http.Server{
 		Addr:         addr,
 		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
+		WriteTimeout: max(cfg.Server.WriteTimeout, cfg.Server.BatchTimeout) + 5*time.Second,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
-	if err := e.StartServer(s); err != nil {
-		logging.ErrorLogger.Fatalf("Server failed to start: %v", err)
+	go func() {
+		if err := e.StartServer(s); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Server failed to start", "error", err)
+		}
+	}()
+
+	// Shut down gracefully so in-flight requests finish and pending spans are
+	// exported.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	logging.Logger.Info("Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.WriteTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logging.Logger.Error("Server shutdown failed", "error", err)
 	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"selectorextractor_backend/internal/response"
+	"strings"
+	"time"
+)
+
+// serverFlags configure talking to a running selectorextractor server instead
+// of calling the model directly.
+type serverFlags struct {
+	url     string
+	token   string
+	apiKey  string
+	timeout time.Duration
+}
+
+func (s *serverFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.url, "server", os.Getenv("SELECTOREXTRACTOR_SERVER"), "base URL of a running server, e.g. http://localhost:1323/api/v1")
+	fs.StringVar(&s.token, "token", os.Getenv("SELECTOREXTRACTOR_TOKEN"), "client token for servers in server auth mode")
+	fs.StringVar(&s.apiKey, "api-key", "", "OpenRouter key sent as X-API-Key to servers in client-key mode; never taken from OPENROUTER_API_KEY")
+	fs.DurationVar(&s.timeout, "timeout", 5*time.Minute, "request timeout")
+}
+
+// post sends body to the server and decodes the data of a successful response
+// envelope into out.
+func (s *serverFlags) post(path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.url, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if s.apiKey != "" {
+		req.Header.Set("X-API-Key", s.apiKey)
+	}
+
+	resp, err := (&http.Client{Timeout: s.timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		response.Response
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("unexpected response from server (%s): %w", resp.Status, err)
+	}
+	if !envelope.Success {
+		if envelope.Error != nil {
+			return fmt.Errorf("%s: %s", envelope.Error.Code, envelope.Error.Message)
+		}
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/pkg/extractor"
+	"strings"
+	"text/tabwriter"
+)
+
+// requestFlags are shared by extract and estimate.
+type requestFlags struct {
+	html          string
+	fields        string
+	url           string
+	model         string
+	promptVersion string
+	output        string
+	server        serverFlags
+}
+
+func parseRequestFlags(name string, args []string, cfg *config.Config) (*requestFlags, error) {
+	f := &requestFlags{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&f.html, "html", "-", `HTML file, or "-" for stdin`)
+	fs.StringVar(&f.url, "url", "", "fetch the page from this URL instead of reading -html")
+	fs.StringVar(&f.fields, "fields", "", "YAML or JSON file with the fields to extract (required)")
+	fs.StringVar(&f.model, "model", cfg.AI.DefaultModel, "model to use")
+	fs.StringVar(&f.promptVersion, "prompt-version", "", "prompt version (default: server configuration)")
+	fs.StringVar(&f.output, "output", "table", "output format: json, yaml or table")
+	f.server.register(fs)
+	fs.Parse(args)
+
+	if f.fields == "" {
+		return nil, errors.New("-fields is required")
+	}
+	return f, nil
+}
+
+func (f *requestFlags) request() (ai.SendExtractionMessageRequest, error) {
+	var html []byte
+	if f.url == "" {
+		var err error
+		html, err = readInput(f.html)
+		if err != nil {
+			return ai.SendExtractionMessageRequest{}, err
+		}
+	}
+	fields, err := decodeList[ai.FieldToExtractSelectorsFor](f.fields, "fields")
+	if err != nil {
+		return ai.SendExtractionMessageRequest{}, err
+	}
+	return ai.SendExtractionMessageRequest{
+		HTML:                        string(html),
+		URL:                         f.url,
+		FieldsToExtractSelectorsFor: fields,
+		Model:                       f.model,
+		PromptVersion:               f.promptVersion,
+	}, nil
+}
+
+func loadConfig() *config.Config {
+	cfg := config.Load()
+	// Logs go to stderr so they never mix with command output.
+	cfg.Log.Dir = ""
+	if os.Getenv("LOG_LEVEL") == "" {
+		cfg.Log.Level = "warn"
+	}
+	if err := logging.InitWithWriter(cfg.Log, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+func runExtract(args []string) error {
+	cfg := loadConfig()
+	f, err := parseRequestFlags("extract", args, cfg)
+	if err != nil {
+		return err
+	}
+	request, err := f.request()
+	if err != nil {
+		return err
+	}
+
+	var result ai.SendExtractionMessageResponse
+	if f.server.url != "" {
+		err = f.server.post("/extract", request, &result)
+	} else {
+		result, err = extractLocally(request, cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(f.output, result, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "FIELD\tSELECTOR\tATTRIBUTE\tMETHOD\tREGEX\tFUNCTION\tVALID")
+		writeSelectorRows(w, "", result.Fields)
+		fmt.Fprintf(w, "\nmodel %s, prompt %s, %d input / %d output tokens, $%.6f\n",
+			result.Model, result.PromptVersion, result.Usage.InputTokens, result.Usage.OutputTokens, result.TotalPrice)
+	})
+}
+
+// writeSelectorRows writes one table row per field, followed by a row per
+// fallback and the rows of its child fields named by their path.
+func writeSelectorRows(w *tabwriter.Writer, prefix string, fields []ai.ExtractedSelector) {
+	for _, field := range fields {
+		function := "no"
+		if field.JavaScriptFunction != "" {
+			function = "yes"
+		}
+		method := field.ExtractMethod
+		if field.JSONPath != "" {
+			method += " " + field.JSONPath
+		}
+		if ai.IsRecord(field.Type) {
+			method = field.Type
+		}
+		valid := "yes"
+		if !field.Valid {
+			valid = cell("no: " + field.Reason)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", prefix+field.Field, cell(field.Selector), cell(field.AttributeToGet),
+			cell(method), cell(field.Regex), function, valid)
+		for i, fallback := range field.Fallbacks {
+			method := fallback.ExtractMethod
+			if fallback.JSONPath != "" {
+				method += " " + fallback.JSONPath
+			}
+			fmt.Fprintf(w, "  fallback %d\t%s\t%s\t%s\t%s\t\t\n", i+1, cell(fallback.Selector), cell(fallback.AttributeToGet),
+				cell(method), cell(fallback.Regex))
+		}
+		writeSelectorRows(w, prefix+field.Field+".", field.Fields)
+	}
+}
+
+func extractLocally(request ai.SendExtractionMessageRequest, cfg *config.Config) (ai.SendExtractionMessageResponse, error) {
+	provider, err := ai.NewProvider(cfg.AI)
+	if err != nil {
+		return ai.SendExtractionMessageResponse{}, err
+	}
+	if provider.RequiresAPIKey() && len(cfg.AI.OpenRouterAPIKeys) == 0 {
+		return ai.SendExtractionMessageResponse{}, errors.New("OPENROUTER_API_KEY is not set; set it or use -server")
+	}
+
+	ext, err := extractor.New(
+		extractor.WithConfig(cfg.AI),
+		extractor.WithProvider(provider),
+		extractor.WithKeys(ai.NewKeyPool(cfg.AI.OpenRouterAPIKeys, cfg.AI.KeyCooldown)),
+		extractor.WithFetchConfig(cfg.Fetch),
+	)
+	if err != nil {
+		return ai.SendExtractionMessageResponse{}, err
+	}
+	return ext.Extract(context.Background(), request)
+}
+
+func runEstimate(args []string) error {
+	cfg := loadConfig()
+	f, err := parseRequestFlags("estimate", args, cfg)
+	if err != nil {
+		return err
+	}
+	request, err := f.request()
+	if err != nil {
+		return err
+	}
+
+	var estimate ai.UsageEstimate
+	if f.server.url != "" {
+		err = f.server.post("/estimate", request, &estimate)
+	} else {
+		var ext *extractor.Extractor
+		ext, err = extractor.New(extractor.WithConfig(cfg.AI), extractor.WithFetchConfig(cfg.Fetch))
+		if err == nil {
+			estimate, err = ext.Estimate(context.Background(), request)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(f.output, estimate, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "MODEL\tPROMPT\tINPUT TOKENS\tMAX OUTPUT TOKENS\tMAX PRICE")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t$%.6f\n", estimate.Model, estimate.PromptVersion,
+			estimate.Usage.InputTokens, estimate.Usage.OutputTokens, estimate.TotalPrice)
+	})
+}
+
+// testResult holds the values the saved selectors produce for one document.
+type testResult struct {
+	File string `json:"file"`
+	// Values holds the converted value of each field, a list of values for
+	// multi-valued fields, or the record read for object and array fields.
+	Values map[string]any    `json:"values"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func runTest(args []string) error {
+	loadConfig()
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	selectorsFile := fs.String("selectors", "", "JSON or YAML file with saved selectors, e.g. the output of extract -output json (required)")
+	output := fs.String("output", "table", "output format: json, yaml or table")
+	fs.Parse(args)
+
+	if *selectorsFile == "" {
+		return errors.New("-selectors is required")
+	}
+	fields, err := decodeList[ai.ExtractedSelector](*selectorsFile, "fields")
+	if err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	ext, err := extractor.New()
+	if err != nil {
+		return err
+	}
+
+	results := make([]testResult, 0, len(files))
+	for _, file := range files {
+		html, err := readInput(file)
+		if err != nil {
+			return err
+		}
+		results = append(results, applyFields(ext, file, string(html), fields))
+	}
+
+	return writeOutput(*output, results, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "FILE\tFIELD\tVALUE\tERROR")
+		for _, result := range results {
+			for _, field := range fields {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.File, field.Field,
+					cell(listCell(result.Values[field.Field])), cell(result.Errors[field.Field]))
+			}
+		}
+	})
+}
+
+func applyFields(ext *extractor.Extractor, file, html string, fields []ai.ExtractedSelector) testResult {
+	result := testResult{File: file, Values: make(map[string]any), Errors: make(map[string]string)}
+	values, err := ext.Apply(context.Background(), html, fields)
+	if err != nil {
+		for _, field := range fields {
+			result.Errors[field.Field] = err.Error()
+		}
+		return result
+	}
+	for _, value := range values {
+		if value.Value != nil {
+			result.Values[value.Field] = value.Value
+		}
+		if value.Error != "" {
+			result.Errors[value.Field] = value.Error
+		}
+	}
+	return result
+}
+
+// listCell writes a value for the table output: prices and dates as text,
+// the values of multi-valued fields joined, and records as JSON.
+func listCell(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case fmt.Stringer:
+		return value.String()
+	case []any:
+		cells := make([]string, 0, len(value))
+		for _, item := range value {
+			if _, isRecord := item.(map[string]any); isRecord {
+				cells = nil
+				break
+			}
+			cells = append(cells, listCell(item))
+		}
+		if cells != nil {
+			return strings.Join(cells, " | ")
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
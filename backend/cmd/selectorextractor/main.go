@@ -0,0 +1,163 @@
+// Command selectorextractor generates and tests extraction selectors from the
+// terminal.
+//
+// Usage:
+//
+//	selectorextractor extract  -html page.html -fields fields.yaml [-model m] [-output json|yaml|table] [-server url]
+//	selectorextractor estimate -html page.html -fields fields.yaml [-model m] [-server url]
+//	selectorextractor test     -selectors selectors.json [-output json|yaml|table] page1.html page2.html ...
+//
+// Without -server the ai and helpers packages are used directly with the
+// provider configured through the usual environment variables.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `Usage: selectorextractor <command> [flags]
+
+Commands:
+  extract   generate selectors for fields in an HTML document
+  estimate  estimate tokens and price of an extraction without calling the model
+  test      apply saved selectors to one or more HTML files
+
+Run "selectorextractor <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	godotenv.Load()
+
+	var err error
+	switch os.Args[1] {
+	case "extract":
+		err = runExtract(os.Args[2:])
+	case "estimate":
+		err = runEstimate(os.Args[2:])
+	case "test":
+		err = runTest(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// readInput reads a file, or stdin when path is "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// decodeFile decodes a JSON or YAML file into v. YAML is converted to JSON
+// first so that the json struct tags of the API types apply.
+func decodeFile(path string, v any) error {
+	data, err := readInput(path)
+	if err != nil {
+		return err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return json.Unmarshal(trimmed, v)
+	}
+
+	var generic any
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	converted, err := json.Marshal(generic)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return json.Unmarshal(converted, v)
+}
+
+// decodeList decodes a file holding either a list or an object with the list
+// under key, optionally wrapped in the API response envelope.
+func decodeList[T any](path, key string) ([]T, error) {
+	var raw json.RawMessage
+	if err := decodeFile(path, &raw); err != nil {
+		return nil, err
+	}
+
+	var list []T
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, fmt.Errorf("%s: expected a list or an object with %q", path, key)
+	}
+	if data, ok := object["data"]; ok {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := json.Unmarshal(object[key], &list); err != nil {
+		return nil, fmt.Errorf("%s: expected a list or an object with %q", path, key)
+	}
+	return list, nil
+}
+
+func writeOutput(format string, value any, table func(w *tabwriter.Writer)) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		// Round-trip through JSON so YAML keys match the API's JSON names.
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		return encoder.Encode(generic)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, use json, yaml or table", format)
+	}
+}
+
+// cell makes a value printable in a single table cell.
+func cell(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if runes := []rune(value); len(runes) > 80 {
+		value = string(runes[:77]) + "..."
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package ai
+
+// charsPerToken is a conservative average for HTML-heavy prompts.
+const charsPerToken = 3
+
+type UsageEstimate struct {
+	Usage             TokenUsage `json:"usage"`
+	PriceInputTokens  float64    `json:"priceInputTokens"`
+	PriceOutputTokens float64    `json:"priceOutputTokens"`
+	TotalPrice        float64    `json:"totalPrice"`
+	Model             string     `json:"model"`
+	PromptVersion     string     `json:"promptVersion"`
+}
+
+// EstimateUsage estimates the tokens and price of a single extraction attempt
+// without calling the model. Output tokens are taken at the configured maximum,
+// so the estimate is an upper bound for well-behaved responses.
+func EstimateUsage(request SendExtractionMessageRequest, opts Options) (UsageEstimate, error) {
+	request = withPromptVersion(request, opts.Config)
+	systemPrompt, prompt, err := buildPrompts(request)
+	if err != nil {
+		return UsageEstimate{}, err
+	}
+
+	usage := TokenUsage{
+		InputTokens:  (len(systemPrompt) + len(prompt) + charsPerToken - 1) / charsPerToken,
+		OutputTokens: opts.Config.MaxTokens,
+	}
+	priceInputTokens, priceOutputTokens := calculatePrice(opts.models()[request.Model], usage)
+
+	return UsageEstimate{
+		Usage:             usage,
+		PriceInputTokens:  priceInputTokens,
+		PriceOutputTokens: priceOutputTokens,
+		TotalPrice:        priceInputTokens + priceOutputTokens,
+		Model:             request.Model,
+		PromptVersion:     request.PromptVersion,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"selectorextractor_backend/internal/selectors"
+	"slices"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Fallback is an alternative rule for a field whose value sits elsewhere on
+// some pages, such as the sale price layout of a product page. Fallbacks are
+// tried in order when the field's own rule yields no value that converts to
+// the field type.
+type Fallback struct {
+	Selector             string           `json:"selector"`
+	AttributeToGet       string           `json:"attributeToGet"`
+	Regex                string           `json:"regex"`
+	RegexMatchIndexToUse int              `json:"regexMatchIndexToUse"`
+	RegexUse             string           `json:"regexUse"`
+	ExtractMethod        string           `json:"extractMethod"`
+	JSONPath             string           `json:"jsonPath"`
+	Steps                []selectors.Step `json:"steps"`
+}
+
+// Rule returns the declarative part of the fallback for the selectors
+// runtime.
+func (f Fallback) Rule() selectors.Rule {
+	return selectors.Rule{
+		Selector:             f.Selector,
+		AttributeToGet:       f.AttributeToGet,
+		ExtractMethod:        f.ExtractMethod,
+		JSONPath:             f.JSONPath,
+		Regex:                f.Regex,
+		RegexMatchIndexToUse: f.RegexMatchIndexToUse,
+		RegexUse:             f.RegexUse,
+	}
+}
+
+// fallback returns the rule and steps of s as a Fallback.
+func (s ExtractedSelector) fallback() Fallback {
+	return Fallback{
+		Selector:             s.Selector,
+		AttributeToGet:       s.AttributeToGet,
+		Regex:                s.Regex,
+		RegexMatchIndexToUse: s.RegexMatchIndexToUse,
+		RegexUse:             s.RegexUse,
+		ExtractMethod:        s.ExtractMethod,
+		JSONPath:             s.JSONPath,
+		Steps:                s.Steps,
+	}
+}
+
+// Alternatives returns s followed by one copy of s per fallback, carrying the
+// fallback's rule and steps, in the order they are tried.
+func (s ExtractedSelector) Alternatives() []ExtractedSelector {
+	alternatives := make([]ExtractedSelector, 0, 1+len(s.Fallbacks))
+	alternatives = append(alternatives, s)
+	for _, fallback := range s.Fallbacks {
+		alternative := s
+		alternative.Selector = fallback.Selector
+		alternative.AttributeToGet = fallback.AttributeToGet
+		alternative.Regex = fallback.Regex
+		alternative.RegexMatchIndexToUse = fallback.RegexMatchIndexToUse
+		alternative.RegexUse = fallback.RegexUse
+		alternative.ExtractMethod = fallback.ExtractMethod
+		alternative.JSONPath = fallback.JSONPath
+		alternative.Steps = fallback.Steps
+		alternative.Fallbacks = nil
+		alternatives = append(alternatives, alternative)
+	}
+	return alternatives
+}
+
+// WithFallbacks returns s with the rule of other and then its fallbacks
+// appended to the fallbacks of s, leaving out rules s already tries.
+func (s ExtractedSelector) WithFallbacks(other ExtractedSelector) ExtractedSelector {
+	tried := make([]Fallback, 0, len(s.Fallbacks)+1)
+	for _, alternative := range s.Alternatives() {
+		tried = append(tried, alternative.fallback())
+	}
+	s.Fallbacks = slices.Clone(s.Fallbacks)
+	for _, alternative := range other.Alternatives() {
+		candidate := alternative.fallback()
+		if slices.ContainsFunc(tried, func(f Fallback) bool { return sameRule(f, candidate) }) {
+			continue
+		}
+		tried = append(tried, candidate)
+		s.Fallbacks = append(s.Fallbacks, candidate)
+	}
+	return s
+}
+
+func sameRule(a, b Fallback) bool {
+	return a.Rule() == b.Rule() && slices.Equal(a.Steps, b.Steps)
+}
+
+// Reading is a value read by Read.
+type Reading struct {
+	// Value is the typed value, or the list of typed values of a
+	// multi-valued field. If a single value fails to convert, it is the
+	// extracted text.
+	Value any
+	// Raws are the texts the values were converted from.
+	Raws []string
+	// Fallback is the number of the fallback that produced Value, 1 for the
+	// first, or 0 for the field's own rule.
+	Fallback int
+}
+
+// Read reads a single- or multi-valued field from scope with the field's own
+// rule and then each fallback, and returns the first reading whose values are
+// non-empty, convert to the field type and keep its validation rules. If no
+// rule yields one, it returns the reading and failure of the field's own rule.
+func Read(scope *goquery.Selection, field ExtractedSelector, base *url.URL) (Reading, error) {
+	var (
+		first    Reading
+		firstErr error
+	)
+	for i, alternative := range field.Alternatives() {
+		reading, err := read(scope, alternative, base)
+		if err == nil {
+			reading.Fallback = i
+			return reading, nil
+		}
+		if i == 0 {
+			first, firstErr = reading, err
+		}
+	}
+	return first, firstErr
+}
+
+func read(scope *goquery.Selection, field ExtractedSelector, base *url.URL) (Reading, error) {
+	if field.Multiple {
+		raws, err := selectors.ApplyAllIn(scope, field.Rule())
+		if err != nil {
+			return Reading{}, err
+		}
+		if len(raws) == 0 {
+			return Reading{}, errors.New("selector yields no values")
+		}
+		values := make([]any, 0, len(raws))
+		for i, raw := range raws {
+			value, err := field.Convert(raw, base)
+			if err != nil {
+				return Reading{}, fmt.Errorf("value %d: %w", i+1, err)
+			}
+			values = append(values, value)
+		}
+		if err := field.Validation.Check(values); err != nil {
+			return Reading{}, err
+		}
+		return Reading{Value: values, Raws: raws}, nil
+	}
+
+	raw, err := selectors.ApplyIn(scope, field.Rule())
+	if err != nil {
+		return Reading{}, err
+	}
+	if raw == "" {
+		return Reading{Raws: []string{raw}}, errors.New("selector yields an empty value")
+	}
+	value, err := field.Convert(raw, base)
+	if err != nil {
+		return Reading{Value: raw, Raws: []string{raw}}, err
+	}
+	if err := field.Validation.Check(value); err != nil {
+		return Reading{Value: value, Raws: []string{raw}}, err
+	}
+	return Reading{Value: value, Raws: []string{raw}}, nil
+}
+
+// checkRule returns a reason why the rule of field cannot be applied, or ""
+// if it can.
+func checkRule(field ExtractedSelector) string {
+	if field.JSONPath != "" && field.ExtractMethod != selectors.ExtractMethodJSON && field.ExtractMethod != selectors.ExtractMethodJSONLD {
+		return "jsonPath requires extractMethod json or jsonld"
+	}
+	if err := selectors.CheckSteps(field.Steps); err != nil {
+		return err.Error()
+	}
+	if err := selectors.CheckRule(field.Rule()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
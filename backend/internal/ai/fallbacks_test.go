@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"reflect"
+	"selectorextractor_backend/internal/selectors"
+	"testing"
+)
+
+const saleHTML = `<html><body>
+<h1>Trail Runner 2</h1>
+<p class="price"><s class="regular">149,99 €</s><span class="sale">129,99 €</span></p>
+<span class="note">Call for price</span>
+<span class="empty"></span>
+</body></html>`
+
+func TestReadFallbackOrder(t *testing.T) {
+	doc, err := selectors.Parse(saleHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := func(selector string) Fallback {
+		return Fallback{Selector: selector, ExtractMethod: "textContent"}
+	}
+	price := func(selector string, fallbacks ...Fallback) ExtractedSelector {
+		return ExtractedSelector{Field: "price", Selector: selector, ExtractMethod: "textContent", Type: selectors.TypeNumber, Fallbacks: fallbacks}
+	}
+	limit := 140.0
+
+	tests := []struct {
+		name     string
+		field    ExtractedSelector
+		want     any
+		fallback int
+		invalid  bool
+	}{
+		{"own rule first", price(".sale", rule(".regular")), 129.99, 0, false},
+		{"own rule matches nothing", price(".current", rule(".sale"), rule(".regular")), 129.99, 1, false},
+		{"own rule yields an empty value", price(".empty", rule(".sale")), 129.99, 1, false},
+		{"own rule does not convert", price(".note", rule(".sale")), 129.99, 1, false},
+		{"first fallback fails too", price(".current", rule(".note"), rule(".regular")), 149.99, 2, false},
+		{"fallback with its own steps", price(".current", Fallback{Selector: ".note", Steps: []selectors.Step{{Op: selectors.StepStripUnit, Arg: "Call for price"}}}, rule(".sale")), 129.99, 2, false},
+		{
+			"validation rules pick the fallback",
+			func() ExtractedSelector {
+				field := price(".regular", rule(".sale"))
+				field.Validation = &ValueRules{Max: &limit}
+				return field
+			}(),
+			129.99, 1, false,
+		},
+		{"every rule fails", price(".note", rule(".current"), rule(".empty")), "Call for price", 0, true},
+	}
+	for _, test := range tests {
+		reading, err := Read(doc.Selection, test.field, nil)
+		if (err != nil) != test.invalid || reading.Value != test.want || reading.Fallback != test.fallback {
+			t.Errorf("%s: Read = %v from rule %d, %v, want %v from rule %d", test.name, reading.Value, reading.Fallback, err, test.want, test.fallback)
+		}
+	}
+}
+
+func TestReadMultipleFallback(t *testing.T) {
+	doc, err := selectors.Parse(`<ul class="tags"><li>trail</li><li>wide</li></ul>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := ExtractedSelector{
+		Field: "tags", Selector: ".tag", ExtractMethod: "textContent", Multiple: true,
+		Fallbacks: []Fallback{{Selector: ".tags li", ExtractMethod: "textContent"}},
+	}
+	reading, err := Read(doc.Selection, field, nil)
+	if err != nil || !reflect.DeepEqual(reading.Value, []any{"trail", "wide"}) || reading.Fallback != 1 {
+		t.Errorf("Read = %+v, %v, want both tags from fallback 1", reading, err)
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	field := ExtractedSelector{
+		Field: "price", Selector: ".sale", ExtractMethod: "textContent", Type: selectors.TypeNumber,
+		Steps:     []selectors.Step{{Op: selectors.StepParseNumber, Arg: "de"}},
+		Fallbacks: []Fallback{{Selector: "meta[itemprop=price]", AttributeToGet: "content"}, {Selector: ".regular", ExtractMethod: "textContent"}},
+	}
+	alternatives := field.Alternatives()
+	var got []string
+	for i, alternative := range alternatives {
+		got = append(got, alternative.Selector)
+		if alternative.Type != field.Type || alternative.Field != field.Field || i > 0 && alternative.Fallbacks != nil {
+			t.Errorf("alternative %s lost the field or kept fallbacks: %+v", alternative.Selector, alternative)
+		}
+	}
+	if want := []string{".sale", "meta[itemprop=price]", ".regular"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Alternatives = %v, want %v", got, want)
+	}
+	// A fallback carries its own steps, not the field's.
+	if alternatives[1].Steps != nil || alternatives[1].AttributeToGet != "content" {
+		t.Errorf("first fallback = %+v", alternatives[1])
+	}
+}
+
+func TestWithFallbacks(t *testing.T) {
+	current := ExtractedSelector{
+		Field: "price", Selector: ".sale", ExtractMethod: "textContent",
+		Fallbacks: []Fallback{{Selector: ".regular", ExtractMethod: "textContent"}},
+	}
+	other := ExtractedSelector{
+		Field: "price", Selector: ".offer-price", ExtractMethod: "textContent",
+		Fallbacks: []Fallback{
+			{Selector: ".sale", ExtractMethod: "textContent"},
+			{Selector: ".regular", ExtractMethod: "textContent", Steps: []selectors.Step{{Op: selectors.StepTrim}}},
+		},
+	}
+	merged := current.WithFallbacks(other)
+
+	var got []string
+	for _, fallback := range merged.Fallbacks {
+		got = append(got, fallback.Selector)
+	}
+	// Rules current already tries are left out; the same rule with other
+	// steps is kept.
+	if want := []string{".regular", ".offer-price", ".regular"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fallbacks = %v, want %v", got, want)
+	}
+	if merged.Selector != ".sale" || len(current.Fallbacks) != 1 {
+		t.Errorf("WithFallbacks changed the field's own rule or its receiver: %+v, %+v", merged, current)
+	}
+}
@@ -3,37 +3,39 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"net/url"
+	"selectorextractor_backend/internal/codegen"
 	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/fetch"
 	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/metrics"
+	"selectorextractor_backend/internal/selectors"
+	"selectorextractor_backend/internal/tracing"
 	"strings"
+	"time"
 
 	"github.com/revrost/go-openrouter"
 	"github.com/revrost/go-openrouter/jsonschema"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func getSystemPrompt() string {
-	prompt, err := os.ReadFile("internal/ai/SYSTEM_PROMPT.txt")
-	if err != nil {
-		panic(err)
-	}
-	return string(prompt)
-}
-
-func getPrompt() string {
-	prompt, err := os.ReadFile("internal/ai/PROMPT.txt")
-	if err != nil {
-		panic(err)
-	}
-	return string(prompt)
-}
-
 type FieldToExtractSelectorsFor struct {
 	Name           string `json:"name"`
 	Type           string `json:"type"`
 	AdditionalInfo string `json:"additionalInfo"`
+	// Multiple asks for every matching value instead of the first, e.g. all
+	// image URLs of a gallery.
+	Multiple bool `json:"multiple,omitempty"`
+	// Fields are the child fields of object and array fields, read relative
+	// to the element of each record.
+	Fields []FieldToExtractSelectorsFor `json:"fields,omitempty"`
+	// Values are the allowed values of enum fields.
+	Values []string `json:"values,omitempty"`
+	// Validation describes what a correct value looks like. Returned
+	// selectors whose values break it fail validation.
+	Validation *ValueRules `json:"validation,omitempty"`
 }
 
 var MODEL_LIST = []string{
@@ -73,9 +75,43 @@ var MODEL_PRICE_MAP = map[string]ModelPrice{
 }
 
 type SendExtractionMessageRequest struct {
-	HTML                        string                       `json:"html"`
+	HTML string `json:"html"`
+	// URL is fetched by the server when HTML is empty.
+	URL   string         `json:"url,omitempty"`
+	Fetch *fetch.Options `json:"fetch,omitempty"`
+	// BaseURL is the address relative links and images of HTML resolve
+	// against when the page has no <base> element. It defaults to URL.
+	BaseURL                     string                       `json:"baseUrl,omitempty"`
 	FieldsToExtractSelectorsFor []FieldToExtractSelectorsFor `json:"fieldsToExtractSelectorsFor"`
 	Model                       string                       `json:"model"`
+	PromptVersion               string                       `json:"promptVersion,omitempty"`
+	// SourceHTML is the document before cleaning. Selectors are validated
+	// against it when set, since cleaning removes the scripts and meta tags
+	// structured data lives in.
+	SourceHTML string `json:"-"`
+	// StructuredData describes the JSON-LD, microdata, RDFa and OpenGraph
+	// data and the embedded application state found in SourceHTML for the
+	// prompt.
+	StructuredData string `json:"-"`
+	// Invalid lists the fields of the previous attempt that failed
+	// validation, for the model to fix.
+	Invalid []FieldValidation `json:"-"`
+}
+
+// documentURL returns the address of the request's HTML, if known.
+func (r SendExtractionMessageRequest) documentURL() string {
+	if r.BaseURL != "" {
+		return r.BaseURL
+	}
+	return r.URL
+}
+
+// validationHTML returns the HTML returned selectors are checked against.
+func (r SendExtractionMessageRequest) validationHTML() string {
+	if r.SourceHTML != "" {
+		return r.SourceHTML
+	}
+	return r.HTML
 }
 
 type TokenUsage struct {
@@ -94,6 +130,12 @@ type SendExtractionMessageResponse struct {
 	PriceOutputTokens float64             `json:"priceOutputTokens"`
 	TotalPrice        float64             `json:"totalPrice"`
 	Model             string              `json:"model"`
+	PromptVersion     string              `json:"promptVersion"`
+	// URL is the address the HTML was fetched from, after redirects.
+	URL string `json:"url,omitempty"`
+	// Sample is the record the returned fields read from the sample HTML,
+	// set for requests with object or array fields.
+	Sample map[string]any `json:"sample,omitempty"`
 }
 
 type FieldAnalysis struct {
@@ -110,16 +152,92 @@ type ExtractedSelector struct {
 	Regex                string        `json:"regex"`
 	RegexMatchIndexToUse int           `json:"regexMatchIndexToUse"`
 	ExtractMethod        string        `json:"extractMethod"`
+	JSONPath             string        `json:"jsonPath"`
 	RegexUse             string        `json:"regexUse"`
-	JavaScriptFunction   string        `json:"javaScriptFunction"`
-	TypeScriptFunction   string        `json:"typeScriptFunction"`
-	PythonFunction       string        `json:"pythonFunction"`
-	GoFunction           string        `json:"goFunction"`
+	// Steps post-process the value the rule extracts before it is
+	// converted into the field type.
+	Steps []selectors.Step `json:"steps"`
+	// Fallbacks are tried in order when the rule above yields no valid value.
+	Fallbacks          []Fallback `json:"fallbacks"`
+	JavaScriptFunction string     `json:"javaScriptFunction"`
+	TypeScriptFunction string     `json:"typeScriptFunction"`
+	PythonFunction     string     `json:"pythonFunction"`
+	GoFunction         string     `json:"goFunction"`
+	// Multiple is copied from the requested field. The rule is then applied
+	// with selectors.ApplyAll and the functions return lists.
+	Multiple bool `json:"multiple,omitempty" skipschema:"true"`
+	// Type is copied from the requested field. Object and array fields hold
+	// their child fields in Fields, with selectors relative to the element
+	// the parent's selector matches.
+	Type   string              `json:"type,omitempty" skipschema:"true"`
+	Fields []ExtractedSelector `json:"fields,omitempty" skipschema:"true"`
+	// Values are the allowed values of enum fields, copied from the request.
+	Values []string `json:"values,omitempty" skipschema:"true"`
+	// Validation is copied from the request and checked whenever the field
+	// is read.
+	Validation *ValueRules `json:"validation,omitempty" skipschema:"true"`
+	// Valid reports whether the field passed validation against the sample
+	// HTML, and Reason why it did not.
+	Valid  bool   `json:"valid" skipschema:"true"`
+	Reason string `json:"reason,omitempty" skipschema:"true"`
+}
+
+// Rule returns the declarative part of the selector for the selectors runtime.
+func (s ExtractedSelector) Rule() selectors.Rule {
+	return selectors.Rule{
+		Selector:             s.Selector,
+		AttributeToGet:       s.AttributeToGet,
+		ExtractMethod:        s.ExtractMethod,
+		JSONPath:             s.JSONPath,
+		Regex:                s.Regex,
+		RegexMatchIndexToUse: s.RegexMatchIndexToUse,
+		RegexUse:             s.RegexUse,
+	}
+}
+
+// Convert runs the selector's steps on a value it extracted and normalizes
+// the result into the field type, see selectors.Convert. Enum values, numbers
+// left by steps included, are matched against Values as text.
+func (s ExtractedSelector) Convert(value string, base *url.URL) (any, error) {
+	processed, err := selectors.RunSteps(value, s.Steps, base)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type == selectors.TypeEnum {
+		return selectors.MatchEnum(valueText(processed), s.Values)
+	}
+	if number, ok := processed.(float64); ok {
+		return selectors.ConvertNumber(number, value, s.Type, base)
+	}
+	return selectors.Convert(processed.(string), s.Type, base)
+}
+
+// addUsage adds the tokens and price of other to r.
+func (r *SendExtractionMessageResponse) addUsage(other SendExtractionMessageResponse) {
+	r.Usage.InputTokens += other.Usage.InputTokens
+	r.Usage.OutputTokens += other.Usage.OutputTokens
+	r.PriceInputTokens += other.PriceInputTokens
+	r.PriceOutputTokens += other.PriceOutputTokens
+	r.TotalPrice += other.TotalPrice
 }
 
-func createEmptyResponse(model string, usage TokenUsage) SendExtractionMessageResponse {
-	priceInputTokens := float64(usage.InputTokens) / 1_000_000 * MODEL_PRICE_MAP[model].InputTokens
-	priceOutputTokens := float64(usage.OutputTokens) / 1_000_000 * MODEL_PRICE_MAP[model].OutputTokens
+// setUsage replaces the tokens and price of r with those of other.
+func (r *SendExtractionMessageResponse) setUsage(other SendExtractionMessageResponse) {
+	r.Usage = other.Usage
+	r.PriceInputTokens = other.PriceInputTokens
+	r.PriceOutputTokens = other.PriceOutputTokens
+	r.TotalPrice = other.TotalPrice
+}
+
+// calculatePrice returns the input and output price in USD for the given usage.
+func calculatePrice(price ModelPrice, usage TokenUsage) (float64, float64) {
+	priceInputTokens := float64(usage.InputTokens) / 1_000_000 * price.InputTokens
+	priceOutputTokens := float64(usage.OutputTokens) / 1_000_000 * price.OutputTokens
+	return priceInputTokens, priceOutputTokens
+}
+
+func createEmptyResponse(model string, price ModelPrice, usage TokenUsage) SendExtractionMessageResponse {
+	priceInputTokens, priceOutputTokens := calculatePrice(price, usage)
 
 	return SendExtractionMessageResponse{
 		Fields:            []ExtractedSelector{},
@@ -133,7 +251,52 @@ func createEmptyResponse(model string, usage TokenUsage) SendExtractionMessageRe
 
 const MAX_TRIES = 3
 
-func SendExtractionMessageOpenAI(request SendExtractionMessageRequest, apiKey string, config config.AIConfig) (SendExtractionMessageResponse, error) {
+// Options holds everything an extraction needs besides the request itself.
+type Options struct {
+	Provider Provider
+	// Keys hands out provider API keys. Nil means no key, for providers
+	// that require none.
+	Keys KeySource
+	// Models are the models requests may use, with their prices. Nil means
+	// MODEL_PRICE_MAP.
+	Models map[string]ModelPrice
+	// Validator checks the returned selectors against the sample HTML. Nil
+	// means ValidateFields.
+	Validator Validator
+	Config    config.AIConfig
+}
+
+func (o Options) models() map[string]ModelPrice {
+	if o.Models == nil {
+		return MODEL_PRICE_MAP
+	}
+	return o.Models
+}
+
+// keys returns the options' KeySource, or one without keys if it is nil.
+func (o Options) keys() KeySource {
+	if o.Keys == nil {
+		return StaticKey("")
+	}
+	return o.Keys
+}
+
+func (o Options) validator() Validator {
+	if o.Validator == nil {
+		return ValidateFields
+	}
+	return o.Validator
+}
+
+func SendExtractionMessageOpenAI(ctx context.Context, request SendExtractionMessageRequest, opts Options) (SendExtractionMessageResponse, error) {
+	request = withPromptVersion(request, opts.Config)
+	ctx, span := tracing.Start(ctx, "SendExtractionMessageOpenAI",
+		attribute.String("model", request.Model),
+		attribute.String("prompt.version", request.PromptVersion),
+	)
+	defer span.End()
+	logger := logging.FromContext(ctx)
+
 	// If no model specified, use a default model order
 	model := request.Model
 	if model == "" {
@@ -141,67 +304,122 @@ func SendExtractionMessageOpenAI(request SendExtractionMessageRequest, apiKey st
 	}
 
 	try_count := 0
-	total_input_tokens := 0
-	total_output_tokens := 0
 	var err error
+	// Attempts whose fields fail validation are retried with the failures
+	// shown to the model. If no attempt passes, the one with the fewest
+	// invalid fields is returned. Every path returns the usage of all
+	// attempts, failed ones included, which spent adds up.
+	var (
+		best        *SendExtractionMessageResponse
+		bestInvalid int
+		spent       SendExtractionMessageResponse
+	)
 	for try_count < MAX_TRIES {
-		fmt.Println("Attempt", try_count+1)
-		response, err := attemptExtractionWithModel(request, apiKey, config)
+		logger.Debug("Starting extraction attempt", "attempt", try_count+1, "model", request.Model)
+		var apiKey string
+		if opts.Provider.RequiresAPIKey() {
+			apiKey, err = opts.keys().Key()
+			if err != nil {
+				break
+			}
+		}
+		attemptCtx, attemptSpan := tracing.Start(ctx, "extraction.attempt",
+			attribute.String("model", request.Model),
+			attribute.Int("attempt", try_count+1),
+			attribute.Int("html.size", len(request.HTML)),
+		)
+		var response SendExtractionMessageResponse
+		response, err = attemptExtractionWithModel(attemptCtx, request, opts, apiKey)
+		attemptSpan.SetAttributes(
+			attribute.Int("tokens.input", response.Usage.InputTokens),
+			attribute.Int("tokens.output", response.Usage.OutputTokens),
+		)
+		if err != nil {
+			tracing.RecordError(attemptSpan, err)
+		}
+		attemptSpan.End()
+		spent.addUsage(response)
+		var invalid *invalidFieldsError
 		if err == nil {
-			fmt.Println("Success")
+			metrics.ExtractionAttempts.WithLabelValues(request.Model, "success").Observe(float64(try_count + 1))
+			response.PromptVersion = request.PromptVersion
+			response.setUsage(spent)
 			return response, nil
+		} else if errors.As(err, &invalid) {
+			logger.Warn("Extraction attempt returned invalid fields", "attempt", try_count+1, "model", request.Model, "invalid", len(invalid.fields))
+			if best == nil || len(invalid.fields) < bestInvalid {
+				best, bestInvalid = &response, len(invalid.fields)
+			}
+			request.Invalid = invalid.fields
+			try_count++
 		} else {
-			fmt.Println("Error", err)
-			total_input_tokens += response.Usage.InputTokens
-			total_output_tokens += response.Usage.OutputTokens
+			logger.Warn("Extraction attempt failed", "attempt", try_count+1, "model", request.Model, "error", err)
+			opts.keys().ReportFailure(apiKey, err)
 			try_count++
 		}
 	}
-	fmt.Println("Failed")
+	if best != nil {
+		logger.Warn("Extraction returned invalid fields", "attempts", try_count, "model", request.Model, "invalid", bestInvalid)
+		metrics.ExtractionAttempts.WithLabelValues(request.Model, "invalid").Observe(float64(try_count))
+		span.SetAttributes(attribute.Int("attempts", try_count))
+		response := *best
+		response.setUsage(spent)
+		response.PromptVersion = request.PromptVersion
+		return response, nil
+	}
+	logger.Error("Extraction failed", "attempts", try_count, "model", request.Model, "error", err)
+	metrics.ExtractionAttempts.WithLabelValues(request.Model, "failure").Observe(float64(try_count))
+	span.SetAttributes(attribute.Int("attempts", try_count))
+	tracing.RecordError(span, err)
 	// If it fails, return the last error
-	return createEmptyResponse(request.Model, TokenUsage{
-			InputTokens:  total_input_tokens,
-			OutputTokens: total_output_tokens,
-		}),
-		fmt.Errorf("extraction failed with all models: last error was %v", err)
+	response := createEmptyResponse(request.Model, opts.models()[request.Model], TokenUsage{})
+	response.setUsage(spent)
+	response.PromptVersion = request.PromptVersion
+	return response, fmt.Errorf("extraction failed with all models: last error was %v", err)
 }
 
-// New helper function to attempt extraction with a single model
-func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey string, config config.AIConfig) (SendExtractionMessageResponse, error) {
-	if apiKey == "" {
-		return createEmptyResponse(request.Model, TokenUsage{}),
-			fmt.Errorf("API key is required")
+// responseSchema returns the JSON schema the model's response must follow.
+// Requests with multi-valued fields get a "multiple" key per field, so that
+// the model states which rules and functions return lists.
+func responseSchema(fields []FieldToExtractSelectorsFor) (*jsonschema.Definition, error) {
+	schema, err := jsonschema.GenerateSchemaForType(OpenRouterResponseSchema{})
+	if err != nil {
+		return nil, err
 	}
-	// Validate the model is in the allowed list
-	var modelFound bool
-	for _, allowedModel := range MODEL_LIST {
-		if request.Model == allowedModel {
-			modelFound = true
-			break
-		}
+	if !anyField(fields, func(field FieldToExtractSelectorsFor) bool { return field.Multiple }) {
+		return schema, nil
+	}
+
+	items := schema.Properties["fields"].Items
+	if items == nil {
+		return nil, fmt.Errorf("response schema has no field items")
 	}
+	items.Properties["multiple"] = jsonschema.Definition{
+		Type:        jsonschema.Boolean,
+		Description: "The requested field's multiple flag: true if the selector matches every value and the functions return lists",
+	}
+	items.Required = append(items.Required, "multiple")
+	return schema, nil
+}
+
+// New helper function to attempt extraction with a single model
+func attemptExtractionWithModel(ctx context.Context, request SendExtractionMessageRequest, opts Options, apiKey string) (SendExtractionMessageResponse, error) {
+	logger := logging.FromContext(ctx)
+	// Validate the model is in the allowed list
+	price, modelFound := opts.models()[request.Model]
 	if !modelFound {
-		return createEmptyResponse(request.Model, TokenUsage{}),
+		return createEmptyResponse(request.Model, price, TokenUsage{}),
 			fmt.Errorf("unsupported model: %s", request.Model)
 	}
 
 	// Existing extraction logic from the original function
-	fieldsToExtractBytes, err := json.Marshal(request.FieldsToExtractSelectorsFor)
+	systemPrompt, prompt, err := buildPrompts(request)
 	if err != nil {
-		logging.ErrorLogger.Printf("Failed to marshal fields to extract: %v", err)
-		return createEmptyResponse(request.Model, TokenUsage{}), err
+		logger.Error("Failed to build prompts", "error", err)
+		return createEmptyResponse(request.Model, price, TokenUsage{}), err
 	}
-	fieldsToExtractString := string(fieldsToExtractBytes)
-
-	client := openrouter.NewClient(apiKey)
-	systemPrompt := getSystemPrompt()
-	prompt := getPrompt()
-
-	prompt = strings.Replace(prompt, "{{HTML}}", request.HTML, 1)
-	prompt = strings.Replace(prompt, "{{FIELDS_TO_EXTRACT}}", fieldsToExtractString, 1)
 
-	logging.InfoLogger.Printf("Sending request to AI API with %d characters of HTML using model %s",
-		len(request.HTML), request.Model)
+	logger.Info("Sending request to AI API", "html_length", len(request.HTML), "model", request.Model)
 
 	messages := []openrouter.ChatCompletionMessage{
 		{
@@ -219,10 +437,10 @@ func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey str
 	}
 
 	var response OpenRouterResponseSchema
-	schema, err := jsonschema.GenerateSchemaForType(response)
+	schema, err := responseSchema(request.FieldsToExtractSelectorsFor)
 	if err != nil {
-		logging.ErrorLogger.Printf("Failed to generate schema for type: %v", err)
-		return createEmptyResponse(request.Model, TokenUsage{}), err
+		logger.Error("Failed to generate schema for type", "error", err)
+		return createEmptyResponse(request.Model, price, TokenUsage{}), err
 	}
 
 	maxReasoningTokens := 5000
@@ -231,8 +449,14 @@ func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey str
 	if request.Model == "x-ai/grok-3-mini" {
 		sorting = openrouter.ProviderSortingPrice
 	}
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
+	callCtx, callSpan := tracing.Start(ctx, "openrouter.CreateChatCompletion",
+		attribute.String("model", request.Model),
+		attribute.Int("prompt.size", len(systemPrompt)+len(prompt)),
+	)
+	start := time.Now()
+	resp, err := opts.Provider.CreateChatCompletion(
+		callCtx,
+		apiKey,
 		openrouter.ChatCompletionRequest{
 			Model:    request.Model,
 			Messages: messages,
@@ -253,43 +477,57 @@ func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey str
 				MaxTokens: &maxReasoningTokens,
 				Exclude:   &exclude,
 			},
-			MaxTokens:   config.MaxTokens,
-			Temperature: config.Temperature,
+			MaxTokens:   opts.Config.MaxTokens,
+			Temperature: opts.Config.Temperature,
 		},
 	)
+	metrics.UpstreamRequestDuration.WithLabelValues(request.Model).Observe(time.Since(start).Seconds())
 	if err != nil {
-		logging.ErrorLogger.Printf("AI API request failed for model %s: %v", request.Model, err)
-		return createEmptyResponse(request.Model, TokenUsage{}), err
+		tracing.RecordError(callSpan, err)
+		callSpan.End()
+		metrics.UpstreamErrors.WithLabelValues(request.Model).Inc()
+		logger.Error("AI API request failed", "model", request.Model, "error", err)
+		return createEmptyResponse(request.Model, price, TokenUsage{}), err
 	}
 
+	if resp.Usage == nil {
+		resp.Usage = &openrouter.Usage{}
+	}
 	usage := TokenUsage{
 		InputTokens:  resp.Usage.PromptTokens,
 		OutputTokens: resp.Usage.CompletionTokens,
 	}
+	callSpan.SetAttributes(
+		attribute.Int("tokens.input", usage.InputTokens),
+		attribute.Int("tokens.output", usage.OutputTokens),
+		attribute.Int("tokens.reasoning", resp.Usage.CompletionTokenDetails.ReasoningTokens),
+	)
+	callSpan.End()
 
-	b, _ := json.MarshalIndent(resp, "", "\t")
-	log.Printf("Response: %s", string(b))
-	responseBytes, err := json.MarshalIndent(resp, "", "  ")
-	if err != nil {
-		logging.ErrorLogger.Printf("Failed to marshal response: %v", err)
-		return createEmptyResponse(request.Model, usage), fmt.Errorf("failed to marshal response: %v", err)
-	}
-	err = os.WriteFile("response.json", responseBytes, 0644)
-	if err != nil {
-		logging.ErrorLogger.Printf("Failed to save response to file: %v", err)
-		return createEmptyResponse(request.Model, usage), fmt.Errorf("failed to save response: %v", err)
+	priceInputTokens := float64(resp.Usage.PromptTokens) / 1_000_000 * price.InputTokens
+	priceOutputTokens := float64(resp.Usage.CompletionTokens)/1_000_000*price.OutputTokens + float64(resp.Usage.CompletionTokenDetails.ReasoningTokens)/1_000_000*price.OutputTokens
+	metrics.Tokens.WithLabelValues(request.Model, "input").Add(float64(usage.InputTokens))
+	metrics.Tokens.WithLabelValues(request.Model, "output").Add(float64(usage.OutputTokens))
+	metrics.CostUSD.WithLabelValues(request.Model).Add(priceInputTokens + priceOutputTokens)
+
+	if len(resp.Choices) == 0 {
+		logger.Error("AI API returned no choices", "model", request.Model)
+		return createEmptyResponse(request.Model, price, usage), fmt.Errorf("AI API returned no choices")
 	}
 
 	jsonStr := resp.Choices[0].Message.Content.Text
+	logger.Debug("Received AI API response",
+		"id", resp.ID,
+		"input_tokens", usage.InputTokens,
+		"output_tokens", usage.OutputTokens,
+		"response", jsonStr)
 
 	err = json.Unmarshal([]byte(jsonStr), &response)
 	if err != nil {
-		logging.ErrorLogger.Printf("Failed to unmarshal response JSON: %v", err)
-		return createEmptyResponse(request.Model, usage), fmt.Errorf("failed to unmarshal response: %v", err)
+		logger.Error("Failed to unmarshal response JSON", "error", err)
+		return createEmptyResponse(request.Model, price, usage), fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
-	priceInputTokens := float64(resp.Usage.PromptTokens) / 1_000_000 * MODEL_PRICE_MAP[request.Model].InputTokens
-	priceOutputTokens := float64(resp.Usage.CompletionTokens)/1_000_000*MODEL_PRICE_MAP[request.Model].OutputTokens + float64(resp.Usage.CompletionTokenDetails.ReasoningTokens)/1_000_000*MODEL_PRICE_MAP[request.Model].OutputTokens
 	apiResponse := SendExtractionMessageResponse{
 		Fields:            response.Fields,
 		Usage:             usage,
@@ -299,7 +537,8 @@ func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey str
 		PriceOutputTokens: priceOutputTokens,
 	}
 
-	for _, field := range apiResponse.Fields {
+	for i := range apiResponse.Fields {
+		field := &apiResponse.Fields[i]
 		field.JavaScriptFunction = strings.TrimSpace(field.JavaScriptFunction)
 		field.TypeScriptFunction = strings.TrimSpace(field.TypeScriptFunction)
 		field.PythonFunction = strings.TrimSpace(field.PythonFunction)
@@ -307,10 +546,60 @@ func attemptExtractionWithModel(request SendExtractionMessageRequest, apiKey str
 		field.Regex = strings.TrimSpace(field.Regex)
 		field.Selector = strings.TrimSpace(field.Selector)
 		field.AttributeToGet = strings.TrimSpace(field.AttributeToGet)
+		field.JSONPath = strings.TrimSpace(field.JSONPath)
 		field.Field = strings.TrimSpace(field.Field)
 		field.FieldAnalysis.ChosenSelectorRationale = strings.TrimSpace(field.FieldAnalysis.ChosenSelectorRationale)
+		for j := range field.Fallbacks {
+			fallback := &field.Fallbacks[j]
+			fallback.Selector = strings.TrimSpace(fallback.Selector)
+			fallback.AttributeToGet = strings.TrimSpace(fallback.AttributeToGet)
+			fallback.Regex = strings.TrimSpace(fallback.Regex)
+			fallback.JSONPath = strings.TrimSpace(fallback.JSONPath)
+		}
 	}
-	logging.InfoLogger.Printf("Extraction completed successfully. Total price: $%.6f", apiResponse.TotalPrice)
+	// Child fields come back flat, named by their path, and are moved under
+	// their parents.
+	apiResponse.Fields = nestFields(request.FieldsToExtractSelectorsFor, apiResponse.Fields)
+	for i := range apiResponse.Fields {
+		field := &apiResponse.Fields[i]
+		if IsRecord(field.Type) {
+			continue
+		}
+		// Functions for rules reading JSON are generated rather than trusted
+		// to the model, so that they follow the rule exactly.
+		if functions, ok := codegen.ForRule(field.Rule(), field.Multiple); ok {
+			field.JavaScriptFunction = functions.JavaScript
+			field.TypeScriptFunction = functions.TypeScript
+			field.PythonFunction = functions.Python
+			field.GoFunction = functions.Go
+		}
+	}
+
+	_, validateSpan := tracing.Start(ctx, "validateFields", attribute.Int("fields.count", len(apiResponse.Fields)))
+	validations := opts.validator()(request.validationHTML(), request.documentURL(), request.FieldsToExtractSelectorsFor, apiResponse.Fields)
+	var invalid []FieldValidation
+	for _, validation := range validations {
+		result := "pass"
+		if !validation.Valid {
+			result = "fail"
+			invalid = append(invalid, validation)
+			logger.Debug("Field failed validation", "field", validation.Field, "reason", validation.Reason)
+		}
+		metrics.FieldValidations.WithLabelValues(validation.Type, result).Inc()
+	}
+	markValidity(apiResponse.Fields, "", validations)
+	validateSpan.SetAttributes(attribute.Int("fields.invalid", len(invalid)))
+	validateSpan.End()
+
+	if anyField(request.FieldsToExtractSelectorsFor, func(field FieldToExtractSelectorsFor) bool { return IsRecord(field.Type) }) {
+		apiResponse.Sample = sampleRecord(request.validationHTML(), request.documentURL(), apiResponse.Fields)
+	}
+
+	if len(invalid) > 0 {
+		return apiResponse, &invalidFieldsError{fields: invalid}
+	}
+
+	logger.Info("Extraction completed successfully", "total_price", apiResponse.TotalPrice)
 
 	return apiResponse, nil
 }
@@ -0,0 +1,96 @@
+package ai
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/revrost/go-openrouter"
+)
+
+var ErrNoAPIKeyAvailable = errors.New("no provider API key available")
+
+// KeySource hands out provider API keys for individual attempts.
+type KeySource interface {
+	Key() (string, error)
+	// ReportFailure tells the source that a call made with key failed with err.
+	ReportFailure(key string, err error)
+}
+
+// StaticKey is a KeySource that always returns the same key, e.g. a key
+// supplied by the client in the X-API-Key header.
+type StaticKey string
+
+func (k StaticKey) Key() (string, error) {
+	if k == "" {
+		return "", ErrNoAPIKeyAvailable
+	}
+	return string(k), nil
+}
+
+func (k StaticKey) ReportFailure(string, error) {}
+
+// KeyPool rotates round-robin over server-managed provider keys. Keys that are
+// rejected by the provider or run into its rate limits are skipped for a
+// cooldown period.
+type KeyPool struct {
+	mu       sync.Mutex
+	keys     []string
+	next     int
+	cooldown time.Duration
+	benched  map[string]time.Time
+}
+
+func NewKeyPool(keys []string, cooldown time.Duration) *KeyPool {
+	return &KeyPool{
+		keys:     keys,
+		cooldown: cooldown,
+		benched:  make(map[string]time.Time),
+	}
+}
+
+func (p *KeyPool) Key() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(p.keys); i++ {
+		key := p.keys[p.next]
+		p.next = (p.next + 1) % len(p.keys)
+		if until, ok := p.benched[key]; ok && now.Before(until) {
+			continue
+		}
+		delete(p.benched, key)
+		return key, nil
+	}
+	return "", ErrNoAPIKeyAvailable
+}
+
+func (p *KeyPool) ReportFailure(key string, err error) {
+	if !isKeyError(err) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.benched[key] = time.Now().Add(p.cooldown)
+}
+
+// isKeyError reports whether err indicates a problem with the key itself
+// (invalid, out of credits or rate limited) rather than with the request.
+func isKeyError(err error) bool {
+	status := 0
+	var apiErr *openrouter.APIError
+	var reqErr *openrouter.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+	switch status {
+	case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
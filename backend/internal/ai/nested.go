@@ -0,0 +1,249 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"selectorextractor_backend/internal/selectors"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Field types with child fields. An object is read from the first element its
+// selector matches, an array gives one object per match; the children's
+// selectors are relative to that element.
+const (
+	FieldTypeObject = "object"
+	FieldTypeArray  = "array"
+)
+
+// maxRecordDepth bounds how deeply records may be nested.
+const maxRecordDepth = 4
+
+// IsRecord reports whether fields of the given type have child fields.
+func IsRecord(fieldType string) bool {
+	return fieldType == FieldTypeObject || fieldType == FieldTypeArray
+}
+
+// CheckFields checks the shape of requested fields. Names must be set, unique
+// among their siblings and free of ".", which separates the names in a child's
+// path. Exactly the object and array fields have children, exactly the enum
+// fields have allowed values, and validation rules must fit the field type.
+func CheckFields(fields []FieldToExtractSelectorsFor) error {
+	return checkFields(fields, "", 0)
+}
+
+func checkFields(fields []FieldToExtractSelectorsFor, prefix string, depth int) error {
+	if depth > maxRecordDepth {
+		return fmt.Errorf("fields are nested more than %d levels deep", maxRecordDepth)
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		path := prefix + field.Name
+		switch {
+		case strings.TrimSpace(field.Name) == "":
+			return fmt.Errorf("a field in %q has no name", strings.TrimSuffix(prefix, "."))
+		case strings.Contains(field.Name, ".") && IsRecord(field.Type):
+			return fmt.Errorf("field %q: names of object and array fields must not contain \".\"", path)
+		case prefix != "" && strings.Contains(field.Name, "."):
+			return fmt.Errorf("field %q: names of child fields must not contain \".\"", path)
+		case seen[field.Name]:
+			return fmt.Errorf("field %q is requested twice", path)
+		case IsRecord(field.Type) && len(field.Fields) == 0:
+			return fmt.Errorf("field %q: %s fields need child fields", path, field.Type)
+		case !IsRecord(field.Type) && len(field.Fields) > 0:
+			return fmt.Errorf("field %q: only object and array fields can have child fields", path)
+		case field.Type == selectors.TypeEnum && len(field.Values) == 0:
+			return fmt.Errorf("field %q: enum fields need allowed values", path)
+		case field.Type != selectors.TypeEnum && len(field.Values) > 0:
+			return fmt.Errorf("field %q: only enum fields can have allowed values", path)
+		}
+		if err := field.Validation.check(field.Type); err != nil {
+			return fmt.Errorf("field %q: %w", path, err)
+		}
+		seen[field.Name] = true
+		if err := checkFields(field.Fields, path+".", depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anyField reports whether match holds for any of fields or their children.
+func anyField(fields []FieldToExtractSelectorsFor, match func(FieldToExtractSelectorsFor) bool) bool {
+	for _, field := range fields {
+		if match(field) || anyField(field.Fields, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkFields calls fn for each of fields and their children, depth first,
+// with the field's path.
+func walkFields(fields []FieldToExtractSelectorsFor, prefix string, fn func(path string, field FieldToExtractSelectorsFor)) {
+	for _, field := range fields {
+		fn(prefix+field.Name, field)
+		walkFields(field.Fields, prefix+field.Name+".", fn)
+	}
+}
+
+// nestFields turns the flat list the model returns, where child fields are
+// named by their path ("seller.name"), into a tree following the request. It
+// copies each field's type, multiple flag, allowed values and validation
+// rules from the request. Entries that match no requested field stay at the
+// top level.
+func nestFields(requested []FieldToExtractSelectorsFor, flat []ExtractedSelector) []ExtractedSelector {
+	specs := make(map[string]FieldToExtractSelectorsFor)
+	walkFields(requested, "", func(path string, field FieldToExtractSelectorsFor) {
+		specs[path] = field
+	})
+	children := make(map[string]bool)
+	for _, field := range requested {
+		walkFields(field.Fields, field.Name+".", func(path string, _ FieldToExtractSelectorsFor) {
+			children[path] = true
+		})
+	}
+
+	returned := make(map[string]ExtractedSelector, len(flat))
+	for _, field := range flat {
+		if _, ok := returned[field.Field]; !ok {
+			returned[field.Field] = field
+		}
+	}
+
+	var build func(path string, field ExtractedSelector) ExtractedSelector
+	build = func(path string, field ExtractedSelector) ExtractedSelector {
+		spec, ok := specs[path]
+		if !ok {
+			return field
+		}
+		field.Type = spec.Type
+		field.Values = spec.Values
+		field.Validation = spec.Validation
+		field.Multiple = spec.Multiple && !IsRecord(spec.Type)
+		field.Fields = nil
+		for _, child := range spec.Fields {
+			childPath := path + "." + child.Name
+			if returnedChild, ok := returned[childPath]; ok {
+				returnedChild = build(childPath, returnedChild)
+				returnedChild.Field = child.Name
+				field.Fields = append(field.Fields, returnedChild)
+			}
+		}
+		return field
+	}
+
+	tree := make([]ExtractedSelector, 0, len(flat))
+	for _, field := range flat {
+		if !children[field.Field] {
+			tree = append(tree, build(field.Field, field))
+		}
+	}
+	return tree
+}
+
+// Issue is a problem reading one field of a record, named by its path.
+type Issue struct {
+	Path   string
+	Reason string
+}
+
+// Evaluate reads field within scope: plain fields give their value converted
+// to the field type, or a list for multi-valued fields; object fields a map of
+// their children read within the first element the selector matches; array
+// fields a list of such maps, one per match. Missing and empty values are
+// returned as issues. A child of an array is only reported if it fails in
+// every element.
+func Evaluate(scope *goquery.Selection, field ExtractedSelector, base *url.URL) (any, []Issue) {
+	return evaluate(scope, field, field.Field, base)
+}
+
+func evaluate(scope *goquery.Selection, field ExtractedSelector, path string, base *url.URL) (any, []Issue) {
+	issue := func(reason string) []Issue {
+		return []Issue{{Path: path, Reason: reason}}
+	}
+
+	switch {
+	case IsRecord(field.Type):
+		containers, err := selectors.Select(scope, field.Selector)
+		if err != nil {
+			return nil, issue(err.Error())
+		}
+		if field.Type == FieldTypeObject {
+			return evaluateRecord(containers.First(), field, path, base)
+		}
+
+		records := make([]any, 0, containers.Length())
+		var (
+			issues   []Issue
+			failures = make(map[string]int)
+		)
+		for _, container := range containers.EachIter() {
+			record, recordIssues := evaluateRecord(container, field, path, base)
+			records = append(records, record)
+			for _, recordIssue := range recordIssues {
+				if failures[recordIssue.Path]++; failures[recordIssue.Path] == 1 {
+					issues = append(issues, recordIssue)
+				}
+			}
+		}
+		everywhere := issues[:0]
+		for _, recordIssue := range issues {
+			if failures[recordIssue.Path] == len(records) {
+				everywhere = append(everywhere, recordIssue)
+			}
+		}
+		return records, everywhere
+
+	default:
+		reading, err := Read(scope, field, base)
+		if err != nil {
+			return reading.Value, issue(err.Error())
+		}
+		return reading.Value, nil
+	}
+}
+
+func evaluateRecord(container *goquery.Selection, field ExtractedSelector, path string, base *url.URL) (map[string]any, []Issue) {
+	record := make(map[string]any, len(field.Fields))
+	var issues []Issue
+	for _, child := range field.Fields {
+		value, childIssues := evaluate(container, child, path+"."+child.Field, base)
+		record[child.Field] = value
+		issues = append(issues, childIssues...)
+	}
+	return record, issues
+}
+
+// IssuesError joins issues into one error, or returns nil if there are none.
+func IssuesError(issues []Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		messages = append(messages, issue.Path+": "+issue.Reason)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// sampleRecord reads every returned field from html into one nested value,
+// as a scraper using the plan would, resolving links against the document's
+// base URL. Function-only fields are left out.
+func sampleRecord(html, documentURL string, fields []ExtractedSelector) map[string]any {
+	doc, err := selectors.Parse(html)
+	if err != nil {
+		return nil
+	}
+	base, _ := selectors.BaseURL(doc, documentURL)
+	sample := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if field.Selector == "" {
+			continue
+		}
+		sample[field.Field], _ = Evaluate(doc.Selection, field, base)
+	}
+	return sample
+}
@@ -0,0 +1,215 @@
+package ai
+
+import (
+	"net/url"
+	"reflect"
+	"selectorextractor_backend/internal/selectors"
+	"testing"
+)
+
+const listingHTML = `<html><body>
+<div class="seller"><span class="name">Northpeak</span><a href="/sellers/northpeak">profile</a></div>
+<ul>
+  <li class="offer"><span class="size">42</span><span class="price">129,99 €</span><i>trail</i><i>wide</i></li>
+  <li class="offer"><span class="size">43</span><span class="price">119,99 €</span></li>
+  <li class="offer"><span class="size">44</span></li>
+</ul>
+</body></html>`
+
+func text(name, selector string) ExtractedSelector {
+	return ExtractedSelector{Field: name, Selector: selector, ExtractMethod: "textContent"}
+}
+
+func TestEvaluate(t *testing.T) {
+	doc, err := selectors.Parse(listingHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://shop.example/p/1")
+
+	price := text("price", ".price")
+	price.Type = selectors.TypePrice
+	tags := text("tags", "i")
+	tags.Multiple = true
+	profile := ExtractedSelector{Field: "profile", Selector: "a", AttributeToGet: "href", Type: selectors.TypeLink}
+	seller := ExtractedSelector{Field: "seller", Selector: ".seller", Type: FieldTypeObject, Fields: []ExtractedSelector{text("name", ".name"), profile}}
+	offers := ExtractedSelector{Field: "offers", Selector: "li.offer", Type: FieldTypeArray, Fields: []ExtractedSelector{text("size", ".size"), price}}
+	offersWithTags := offers
+	offersWithTags.Fields = append([]ExtractedSelector{}, offers.Fields...)
+	offersWithTags.Fields = append(offersWithTags.Fields, tags)
+	store := ExtractedSelector{Field: "store", Selector: "body", Type: FieldTypeObject, Fields: []ExtractedSelector{seller, offers}}
+
+	euros := func(amount float64) selectors.Price { return selectors.Price{Amount: amount, Currency: "EUR"} }
+	tests := []struct {
+		name   string
+		field  ExtractedSelector
+		want   any
+		issues []Issue
+	}{
+		{
+			name:  "object",
+			field: seller,
+			want:  map[string]any{"name": "Northpeak", "profile": "https://shop.example/sellers/northpeak"},
+		},
+		{
+			// Children of an array are only reported if they fail in every
+			// element.
+			name:  "array",
+			field: offers,
+			want: []any{
+				map[string]any{"size": "42", "price": euros(129.99)},
+				map[string]any{"size": "43", "price": euros(119.99)},
+				map[string]any{"size": "44", "price": nil},
+			},
+		},
+		{
+			name:  "multi-valued child",
+			field: offersWithTags,
+			want: []any{
+				map[string]any{"size": "42", "price": euros(129.99), "tags": []any{"trail", "wide"}},
+				map[string]any{"size": "43", "price": euros(119.99), "tags": nil},
+				map[string]any{"size": "44", "price": nil, "tags": nil},
+			},
+		},
+		{
+			name:  "nested records",
+			field: store,
+			want: map[string]any{
+				"seller": map[string]any{"name": "Northpeak", "profile": "https://shop.example/sellers/northpeak"},
+				"offers": []any{
+					map[string]any{"size": "42", "price": euros(129.99)},
+					map[string]any{"size": "43", "price": euros(119.99)},
+					map[string]any{"size": "44", "price": nil},
+				},
+			},
+		},
+		{
+			name:   "child missing everywhere",
+			field:  ExtractedSelector{Field: "offers", Selector: "li.offer", Type: FieldTypeArray, Fields: []ExtractedSelector{text("color", ".color")}},
+			want:   []any{map[string]any{"color": nil}, map[string]any{"color": nil}, map[string]any{"color": nil}},
+			issues: []Issue{{Path: "offers.color"}},
+		},
+		{
+			name:   "object without container",
+			field:  ExtractedSelector{Field: "shipping", Selector: ".shipping", Type: FieldTypeObject, Fields: []ExtractedSelector{text("cost", ".cost")}},
+			issues: []Issue{{Path: "shipping"}},
+		},
+		{
+			name:   "array without matches",
+			field:  ExtractedSelector{Field: "reviews", Selector: ".review", Type: FieldTypeArray, Fields: []ExtractedSelector{text("text", "p")}},
+			issues: []Issue{{Path: "reviews"}},
+		},
+	}
+	for _, test := range tests {
+		got, issues := Evaluate(doc.Selection, test.field, base)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Evaluate = %#v, want %#v", test.name, got, test.want)
+		}
+		if !sameIssuePaths(issues, test.issues) {
+			t.Errorf("%s: issues = %+v, want %+v", test.name, issues, test.issues)
+		}
+	}
+}
+
+// sameIssuePaths compares issues by path, as reasons come from the selectors
+// package.
+func sameIssuePaths(got, want []Issue) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Path != want[i].Path {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNestFields(t *testing.T) {
+	requested := []FieldToExtractSelectorsFor{
+		{Name: "title", Type: "text"},
+		{Name: "tags", Type: "text", Multiple: true},
+		{Name: "seller", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{
+			{Name: "name", Type: "text"},
+			{Name: "address", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{{Name: "city", Type: "text"}}},
+		}},
+		{Name: "offers", Type: FieldTypeArray, Multiple: true, Fields: []FieldToExtractSelectorsFor{{Name: "price", Type: "price"}}},
+	}
+	flat := []ExtractedSelector{
+		text("seller.address.city", ".city"),
+		text("title", "h1"),
+		text("seller", ".seller"),
+		text("seller.name", ".name"),
+		text("seller.address", ".address"),
+		text("offers", "li"),
+		text("offers.price", ".price"),
+		text("title", "h2"),
+		text("tags", "i"),
+		text("unknown", ".x"),
+	}
+	got := nestFields(requested, flat)
+
+	summarize := func(fields []ExtractedSelector) []string {
+		var lines []string
+		var walk func(prefix string, fields []ExtractedSelector)
+		walk = func(prefix string, fields []ExtractedSelector) {
+			for _, field := range fields {
+				line := prefix + field.Field + " " + field.Selector + " " + field.Type
+				if field.Multiple {
+					line += " multiple"
+				}
+				lines = append(lines, line)
+				walk(prefix+field.Field+".", field.Fields)
+			}
+		}
+		walk("", fields)
+		return lines
+	}
+	want := []string{
+		"title h1 text",
+		"seller .seller object",
+		"seller.name .name text",
+		"seller.address .address object",
+		"seller.address.city .city text",
+		"offers li array",
+		"offers.price .price price",
+		"title h2 text",
+		"tags i text multiple",
+		"unknown .x ",
+	}
+	if lines := summarize(got); !reflect.DeepEqual(lines, want) {
+		t.Errorf("nestFields =\n%q\nwant\n%q", lines, want)
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	child := func(name, fieldType string) FieldToExtractSelectorsFor {
+		return FieldToExtractSelectorsFor{Name: name, Type: fieldType}
+	}
+	deep := child("leaf", "text")
+	for i := 0; i <= maxRecordDepth; i++ {
+		deep = FieldToExtractSelectorsFor{Name: "level", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{deep}}
+	}
+	tests := []struct {
+		name    string
+		fields  []FieldToExtractSelectorsFor
+		invalid bool
+	}{
+		{"flat", []FieldToExtractSelectorsFor{child("title", "text"), child("meta.title", "text")}, false},
+		{"nested", []FieldToExtractSelectorsFor{{Name: "seller", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{child("name", "text")}}}, false},
+		{"no name", []FieldToExtractSelectorsFor{child(" ", "text")}, true},
+		{"duplicate", []FieldToExtractSelectorsFor{child("title", "text"), child("title", "number")}, true},
+		{"dotted record", []FieldToExtractSelectorsFor{{Name: "a.b", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{child("c", "text")}}}, true},
+		{"dotted child", []FieldToExtractSelectorsFor{{Name: "a", Type: FieldTypeObject, Fields: []FieldToExtractSelectorsFor{child("b.c", "text")}}}, true},
+		{"record without children", []FieldToExtractSelectorsFor{child("offers", FieldTypeArray)}, true},
+		{"children of plain field", []FieldToExtractSelectorsFor{{Name: "title", Type: "text", Fields: []FieldToExtractSelectorsFor{child("a", "text")}}}, true},
+		{"enum without values", []FieldToExtractSelectorsFor{child("color", "enum")}, true},
+		{"values of plain field", []FieldToExtractSelectorsFor{{Name: "color", Type: "text", Values: []string{"red"}}}, true},
+		{"too deep", []FieldToExtractSelectorsFor{deep}, true},
+	}
+	for _, test := range tests {
+		if err := CheckFields(test.fields); (err != nil) != test.invalid {
+			t.Errorf("%s: CheckFields = %v, want invalid %v", test.name, err, test.invalid)
+		}
+	}
+}
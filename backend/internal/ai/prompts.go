@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"selectorextractor_backend/internal/config"
+	"sort"
+	"text/template"
+)
+
+// Prompt templates live in prompts/<version>/{system,user}.tmpl and are
+// compiled into the binary.
+//
+//go:embed prompts
+var promptFS embed.FS
+
+// DefaultPromptVersion is the version of requests that select none. Released
+// versions are never changed, so that results reporting them can be
+// reproduced; prompt changes go into a new version.
+const DefaultPromptVersion = "v2"
+
+type promptTemplates struct {
+	system *template.Template
+	user   *template.Template
+}
+
+// promptData is the data available to the prompt templates.
+type promptData struct {
+	HTML            string
+	FieldsToExtract string
+	Fields          []FieldToExtractSelectorsFor
+	// Multiple reports whether any field asks for a list of values.
+	Multiple bool
+	// Nested reports whether any field is an object or array with child
+	// fields.
+	Nested bool
+	// Types holds the type of every requested field, including child fields.
+	Types map[string]bool
+	// Validation reports whether any field has validation rules.
+	Validation bool
+	// StructuredData lists the page's JSON-LD, microdata, RDFa and OpenGraph
+	// values and the shape of its embedded application state, or is empty if
+	// it has none.
+	StructuredData string
+	// Invalid lists the fields of the previous attempt that failed
+	// validation, or is empty on the first attempt.
+	Invalid []FieldValidation
+}
+
+var promptVersions = mustLoadPromptTemplates()
+
+func mustLoadPromptTemplates() map[string]promptTemplates {
+	entries, err := fs.ReadDir(promptFS, "prompts")
+	if err != nil {
+		panic(err)
+	}
+
+	versions := make(map[string]promptTemplates, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := path.Join("prompts", entry.Name())
+		versions[entry.Name()] = promptTemplates{
+			system: template.Must(template.New("system").Option("missingkey=error").ParseFS(promptFS, path.Join(dir, "system.tmpl"))).Lookup("system.tmpl"),
+			user:   template.Must(template.New("user").Option("missingkey=error").ParseFS(promptFS, path.Join(dir, "user.tmpl"))).Lookup("user.tmpl"),
+		}
+	}
+	return versions
+}
+
+// PromptVersions returns the names of the available prompt versions.
+func PromptVersions() []string {
+	names := make([]string, 0, len(promptVersions))
+	for name := range promptVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsPromptVersion reports whether a prompt version with the given name exists.
+func IsPromptVersion(version string) bool {
+	_, ok := promptVersions[version]
+	return ok
+}
+
+// withPromptVersion fills in the configured prompt version for requests that
+// do not select one.
+func withPromptVersion(request SendExtractionMessageRequest, config config.AIConfig) SendExtractionMessageRequest {
+	if request.PromptVersion == "" {
+		request.PromptVersion = config.PromptVersion
+	}
+	if request.PromptVersion == "" {
+		request.PromptVersion = DefaultPromptVersion
+	}
+	return request
+}
+
+// buildPrompts renders the system and user prompts for a request using the
+// request's prompt version, or DefaultPromptVersion if none is set.
+func buildPrompts(request SendExtractionMessageRequest) (string, string, error) {
+	version := request.PromptVersion
+	if version == "" {
+		version = DefaultPromptVersion
+	}
+	templates, ok := promptVersions[version]
+	if !ok {
+		return "", "", fmt.Errorf("unknown prompt version %q", version)
+	}
+
+	fieldsToExtractBytes, err := json.Marshal(request.FieldsToExtractSelectorsFor)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal fields to extract: %v", err)
+	}
+
+	data := promptData{
+		HTML:            request.HTML,
+		FieldsToExtract: string(fieldsToExtractBytes),
+		Fields:          request.FieldsToExtractSelectorsFor,
+		StructuredData:  request.StructuredData,
+		Invalid:         request.Invalid,
+	}
+	data.Multiple = anyField(request.FieldsToExtractSelectorsFor, func(field FieldToExtractSelectorsFor) bool { return field.Multiple })
+	data.Types = make(map[string]bool)
+	walkFields(request.FieldsToExtractSelectorsFor, "", func(_ string, field FieldToExtractSelectorsFor) {
+		data.Types[field.Type] = true
+	})
+	data.Validation = anyField(request.FieldsToExtractSelectorsFor, func(field FieldToExtractSelectorsFor) bool { return field.Validation != nil })
+	data.Nested = anyField(request.FieldsToExtractSelectorsFor, func(field FieldToExtractSelectorsFor) bool { return IsRecord(field.Type) })
+
+	var system, user bytes.Buffer
+	if err := templates.system.Execute(&system, data); err != nil {
+		return "", "", fmt.Errorf("failed to render system prompt %s: %v", version, err)
+	}
+	if err := templates.user.Execute(&user, data); err != nil {
+		return "", "", fmt.Errorf("failed to render user prompt %s: %v", version, err)
+	}
+
+	return system.String(), user.String(), nil
+}
@@ -0,0 +1,44 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPromptsForEveryVersion(t *testing.T) {
+	request := SendExtractionMessageRequest{
+		HTML: "<h1>Title</h1>",
+		FieldsToExtractSelectorsFor: []FieldToExtractSelectorsFor{
+			{Name: "title", Type: "text"},
+			{Name: "offers", Type: FieldTypeArray, Fields: []FieldToExtractSelectorsFor{{Name: "price", Type: "price"}}},
+		},
+	}
+	for _, version := range PromptVersions() {
+		request.PromptVersion = version
+		system, user, err := buildPrompts(request)
+		if err != nil {
+			t.Errorf("%s: %v", version, err)
+			continue
+		}
+		if system == "" || !strings.Contains(user, request.HTML) || !strings.Contains(user, `"offers"`) {
+			t.Errorf("%s: prompts lack the request's HTML or fields", version)
+		}
+	}
+}
+
+func TestPromptVersions(t *testing.T) {
+	for _, version := range []string{"v1", "v2", DefaultPromptVersion} {
+		if !IsPromptVersion(version) {
+			t.Errorf("prompt version %s is missing", version)
+		}
+	}
+
+	// v1 is the original prompt and knows nothing of the later field types.
+	v1, _, err := buildPrompts(SendExtractionMessageRequest{PromptVersion: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(v1, `"fallbacks"`) {
+		t.Error("v1 system prompt was changed after its release")
+	}
+}
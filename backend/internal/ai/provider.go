@@ -0,0 +1,222 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"selectorextractor_backend/internal/config"
+	"sync"
+
+	"github.com/revrost/go-openrouter"
+)
+
+const (
+	ProviderOpenRouter = "openrouter"
+	ProviderRecord     = "record"
+	ProviderReplay     = "replay"
+	ProviderFake       = "fake"
+)
+
+var ErrNoRecording = errors.New("no recording for request")
+
+// Provider sends chat completion requests to a model provider.
+type Provider interface {
+	CreateChatCompletion(ctx context.Context, apiKey string, request openrouter.ChatCompletionRequest) (openrouter.ChatCompletionResponse, error)
+	// RequiresAPIKey reports whether calls need a provider API key.
+	RequiresAPIKey() bool
+}
+
+// NewProvider creates the provider selected by config.Provider.
+func NewProvider(config config.AIConfig) (Provider, error) {
+	switch config.Provider {
+	case ProviderOpenRouter, "":
+		return OpenRouterProvider{}, nil
+	case ProviderRecord:
+		return &RecordingProvider{Next: OpenRouterProvider{}, Dir: config.RecordingsDir}, nil
+	case ProviderReplay:
+		return &ReplayProvider{Dir: config.RecordingsDir}, nil
+	case ProviderFake:
+		return NewScriptedProviderFromFile(config.FakeScript)
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", config.Provider)
+	}
+}
+
+// OpenRouterProvider calls the OpenRouter API.
+type OpenRouterProvider struct{}
+
+func (OpenRouterProvider) CreateChatCompletion(ctx context.Context, apiKey string, request openrouter.ChatCompletionRequest) (openrouter.ChatCompletionResponse, error) {
+	if apiKey == "" {
+		return openrouter.ChatCompletionResponse{}, fmt.Errorf("API key is required")
+	}
+	return openrouter.NewClient(apiKey).CreateChatCompletion(ctx, request)
+}
+
+func (OpenRouterProvider) RequiresAPIKey() bool { return true }
+
+// recording is the on-disk format of a recorded request/response pair. The
+// request is kept for inspection only; replay looks recordings up by hash.
+type recording struct {
+	Request  json.RawMessage                   `json:"request"`
+	Response openrouter.ChatCompletionResponse `json:"response"`
+}
+
+// RecordingProvider forwards requests to Next and stores every successful
+// request/response pair in Dir, named by the request hash.
+type RecordingProvider struct {
+	Next Provider
+	Dir  string
+}
+
+func (p *RecordingProvider) CreateChatCompletion(ctx context.Context, apiKey string, request openrouter.ChatCompletionRequest) (openrouter.ChatCompletionResponse, error) {
+	response, err := p.Next.CreateChatCompletion(ctx, apiKey, request)
+	if err != nil {
+		return response, err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	hash := hashBytes(requestJSON)
+	data, err := json.MarshalIndent(recording{Request: requestJSON, Response: response}, "", "  ")
+	if err != nil {
+		return response, err
+	}
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return response, err
+	}
+	if err := os.WriteFile(filepath.Join(p.Dir, hash+".json"), data, 0644); err != nil {
+		return response, fmt.Errorf("failed to save recording: %w", err)
+	}
+	return response, nil
+}
+
+func (p *RecordingProvider) RequiresAPIKey() bool { return p.Next.RequiresAPIKey() }
+
+// ReplayProvider answers requests from recordings made by RecordingProvider and
+// never touches the network.
+type ReplayProvider struct {
+	Dir string
+}
+
+func (p *ReplayProvider) CreateChatCompletion(ctx context.Context, apiKey string, request openrouter.ChatCompletionRequest) (openrouter.ChatCompletionResponse, error) {
+	hash, err := RequestHash(request)
+	if err != nil {
+		return openrouter.ChatCompletionResponse{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, hash+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return openrouter.ChatCompletionResponse{}, fmt.Errorf("%w %s in %s", ErrNoRecording, hash, p.Dir)
+	}
+	if err != nil {
+		return openrouter.ChatCompletionResponse{}, err
+	}
+
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return openrouter.ChatCompletionResponse{}, fmt.Errorf("invalid recording %s: %w", hash, err)
+	}
+	return rec.Response, nil
+}
+
+func (p *ReplayProvider) RequiresAPIKey() bool { return false }
+
+// RequestHash identifies a chat completion request by the SHA-256 of its JSON
+// encoding.
+func RequestHash(request openrouter.ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	return hashBytes(data), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ScriptStep is one scripted provider answer: either an error or a message
+// content with the usage to report.
+type ScriptStep struct {
+	Content string           `json:"content"`
+	Error   string           `json:"error,omitempty"`
+	Usage   openrouter.Usage `json:"usage"`
+}
+
+// Answer returns a step answering with fields, as the model does.
+func Answer(fields ...ExtractedSelector) ScriptStep {
+	content, err := json.Marshal(OpenRouterResponseSchema{Fields: fields})
+	if err != nil {
+		return ScriptStep{Error: err.Error()}
+	}
+	return ScriptStep{Content: string(content)}
+}
+
+// ScriptedProvider returns its steps in order, one per call, repeating the last
+// step once the script is exhausted.
+type ScriptedProvider struct {
+	mu    sync.Mutex
+	steps []ScriptStep
+	next  int
+}
+
+func NewScriptedProvider(steps ...ScriptStep) *ScriptedProvider {
+	return &ScriptedProvider{steps: steps}
+}
+
+// NewScriptedProviderFromFile loads a JSON array of ScriptStep values.
+func NewScriptedProviderFromFile(path string) (*ScriptedProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the fake AI provider requires AI_FAKE_SCRIPT")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fake script: %w", err)
+	}
+	var steps []ScriptStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse fake script: %w", err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("fake script %s has no steps", path)
+	}
+	return NewScriptedProvider(steps...), nil
+}
+
+func (p *ScriptedProvider) CreateChatCompletion(ctx context.Context, apiKey string, request openrouter.ChatCompletionRequest) (openrouter.ChatCompletionResponse, error) {
+	p.mu.Lock()
+	if len(p.steps) == 0 {
+		p.mu.Unlock()
+		return openrouter.ChatCompletionResponse{}, errors.New("scripted provider has no steps")
+	}
+	step := p.steps[min(p.next, len(p.steps)-1)]
+	p.next++
+	call := p.next
+	p.mu.Unlock()
+
+	if step.Error != "" {
+		return openrouter.ChatCompletionResponse{}, errors.New(step.Error)
+	}
+
+	usage := step.Usage
+	return openrouter.ChatCompletionResponse{
+		ID:    fmt.Sprintf("fake-%d", call),
+		Model: request.Model,
+		Choices: []openrouter.ChatCompletionChoice{{
+			Message: openrouter.ChatCompletionMessage{
+				Role:    openrouter.ChatMessageRoleAssistant,
+				Content: openrouter.Content{Text: step.Content},
+			},
+		}},
+		Usage: &usage,
+	}, nil
+}
+
+func (p *ScriptedProvider) RequiresAPIKey() bool { return false }
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"selectorextractor_backend/internal/config"
+	"testing"
+
+	"github.com/revrost/go-openrouter"
+)
+
+func chatRequest(text string) openrouter.ChatCompletionRequest {
+	return openrouter.ChatCompletionRequest{
+		Model:    "x-ai/grok-3-mini",
+		Messages: []openrouter.ChatCompletionMessage{openrouter.UserMessage(text)},
+	}
+}
+
+func TestScriptedProvider(t *testing.T) {
+	provider := NewScriptedProvider(ScriptStep{Error: "upstream unavailable"}, ScriptStep{Content: "first"}, ScriptStep{Content: "last"})
+	want := []string{"error", "first", "last", "last"}
+	for i, content := range want {
+		response, err := provider.CreateChatCompletion(context.Background(), "", chatRequest("hi"))
+		got := "error"
+		if err == nil {
+			got = response.Choices[0].Message.Content.Text
+		}
+		if got != content {
+			t.Errorf("call %d = %q, want %q", i+1, got, content)
+		}
+	}
+}
+
+func TestScriptedProviderWithoutSteps(t *testing.T) {
+	if _, err := NewScriptedProvider().CreateChatCompletion(context.Background(), "", chatRequest("hi")); err == nil {
+		t.Error("provider without steps answered, want an error")
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	recorder := &RecordingProvider{
+		Next: NewScriptedProvider(ScriptStep{Content: `{"fields": []}`, Usage: openrouter.Usage{PromptTokens: 10, CompletionTokens: 2}}),
+		Dir:  dir,
+	}
+	request := chatRequest("<h1>Title</h1>")
+	recorded, err := recorder.CreateChatCompletion(context.Background(), "", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := &ReplayProvider{Dir: dir}
+	replayed, err := replayer.CreateChatCompletion(context.Background(), "", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %+v, want the recorded %+v", replayed, recorded)
+	}
+
+	if _, err := replayer.CreateChatCompletion(context.Background(), "", chatRequest("<h1>Other</h1>")); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("replay of an unrecorded request = %v, want ErrNoRecording", err)
+	}
+}
+
+func TestRecordingProviderSkipsFailures(t *testing.T) {
+	dir := t.TempDir()
+	recorder := &RecordingProvider{Next: NewScriptedProvider(ScriptStep{Error: "upstream unavailable"}), Dir: dir}
+	request := chatRequest("<h1>Title</h1>")
+	if _, err := recorder.CreateChatCompletion(context.Background(), "", request); err == nil {
+		t.Fatal("recorder hid the provider's error")
+	}
+	if _, err := (&ReplayProvider{Dir: dir}).CreateChatCompletion(context.Background(), "", request); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("replay after a failed call = %v, want ErrNoRecording", err)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     Provider
+		invalid  bool
+	}{
+		{"", OpenRouterProvider{}, false},
+		{ProviderOpenRouter, OpenRouterProvider{}, false},
+		{ProviderReplay, &ReplayProvider{Dir: "recordings"}, false},
+		{ProviderRecord, &RecordingProvider{Next: OpenRouterProvider{}, Dir: "recordings"}, false},
+		{ProviderFake, nil, true},
+		{"anthropic", nil, true},
+	}
+	for _, test := range tests {
+		got, err := NewProvider(config.AIConfig{Provider: test.provider, RecordingsDir: "recordings"})
+		if (err != nil) != test.invalid || !test.invalid && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("NewProvider(%q) = %#v, %v, want %#v", test.provider, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"selectorextractor_backend/internal/selectors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValueRules describe what a correct value of a field looks like. They are
+// shown to the model and checked on the value converted to the field type
+// whenever the field is read, except Example, which only the sample page is
+// checked against.
+type ValueRules struct {
+	// Example is the field's value on the sample page, written as it appears
+	// there or in the normalized form of the field type.
+	Example string `json:"example,omitempty"`
+	// Pattern is a regex the value's text must match. Price fields cannot
+	// have one, nor AllowedValues.
+	Pattern string `json:"pattern,omitempty"`
+	// Min and Max bound the values of number and price fields.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// AllowedValues are the only values the field may have, compared without
+	// regard to case and whitespace.
+	AllowedValues []string `json:"allowedValues,omitempty"`
+	// NonEmpty rejects values that are empty after post-processing.
+	NonEmpty bool `json:"nonEmpty,omitempty"`
+
+	// pattern is Pattern compiled by check.
+	pattern *regexp.Regexp
+}
+
+// check reports whether the rules fit a field of the given type and compiles
+// Pattern for Check. Price fields are bounded with Min and Max only, as their
+// text is the amount and currency, e.g. "12.99 EUR".
+func (r *ValueRules) check(fieldType string) error {
+	if r == nil {
+		return nil
+	}
+	if IsRecord(fieldType) {
+		return fmt.Errorf("%s fields cannot have validation rules", fieldType)
+	}
+	if fieldType == selectors.TypePrice && (r.Pattern != "" || len(r.AllowedValues) > 0) {
+		return errors.New("price fields cannot have a pattern or allowed values; use minimum and maximum")
+	}
+	if r.Pattern != "" {
+		pattern, err := selectors.CompileRegex(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("validation pattern: %w", err)
+		}
+		r.pattern = pattern
+	}
+	if (r.Min != nil || r.Max != nil) && fieldType != selectors.TypeNumber && fieldType != selectors.TypePrice {
+		return errors.New("only number and price fields can have a minimum or maximum")
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("minimum %v is above maximum %v", *r.Min, *r.Max)
+	}
+	return nil
+}
+
+// Check returns why value, or for a list one of its items, breaks the rules,
+// or nil if it keeps them. Example is not checked.
+func (r *ValueRules) Check(value any) error {
+	if r == nil {
+		return nil
+	}
+	// Rules saved with selectors are applied without check.
+	pattern := r.pattern
+	if pattern == nil && r.Pattern != "" {
+		var err error
+		if pattern, err = selectors.CompileRegex(r.Pattern); err != nil {
+			return err
+		}
+	}
+	if values, ok := value.([]any); ok {
+		for i, item := range values {
+			if err := r.checkValue(item, pattern); err != nil {
+				return fmt.Errorf("value %d: %w", i+1, err)
+			}
+		}
+		return nil
+	}
+	return r.checkValue(value, pattern)
+}
+
+func (r *ValueRules) checkValue(value any, pattern *regexp.Regexp) error {
+	text := valueText(value)
+	if r.NonEmpty && strings.TrimSpace(text) == "" {
+		return errors.New("value is empty")
+	}
+	if pattern != nil && !pattern.MatchString(text) {
+		return fmt.Errorf("value %q does not match pattern %q", text, r.Pattern)
+	}
+	if r.Min != nil || r.Max != nil {
+		number, ok := valueNumber(value)
+		switch {
+		case !ok:
+			return fmt.Errorf("value %q is not a number", text)
+		case r.Min != nil && number < *r.Min:
+			return fmt.Errorf("value %v is below the minimum %v", number, *r.Min)
+		case r.Max != nil && number > *r.Max:
+			return fmt.Errorf("value %v is above the maximum %v", number, *r.Max)
+		}
+	}
+	if len(r.AllowedValues) > 0 && !slices.ContainsFunc(r.AllowedValues, func(allowed string) bool { return sameText(allowed, text) }) {
+		return fmt.Errorf("value %q is not one of the allowed values", text)
+	}
+	return nil
+}
+
+// exampleIssues compares the values read from the sample for field and its
+// children with their examples. The child of an array field matches if its
+// value in any item does.
+func exampleIssues(field ExtractedSelector, value any, path string, base *url.URL) []Issue {
+	if !IsRecord(field.Type) {
+		if field.Validation == nil || field.Validation.Example == "" || matchesExample(field, value, base) {
+			return nil
+		}
+		return []Issue{{Path: path, Reason: fmt.Sprintf("value %q does not match the example %q", valueText(value), field.Validation.Example)}}
+	}
+
+	records := []any{value}
+	if field.Type == FieldTypeArray {
+		records, _ = value.([]any)
+	}
+	var issues []Issue
+	for _, child := range field.Fields {
+		var first []Issue
+		for i, record := range records {
+			values, _ := record.(map[string]any)
+			childIssues := exampleIssues(child, values[child.Field], path+"."+child.Field, base)
+			if len(childIssues) == 0 {
+				first = nil
+				break
+			}
+			if i == 0 {
+				first = childIssues
+			}
+		}
+		issues = append(issues, first...)
+	}
+	return issues
+}
+
+// matchesExample reports whether value, or any item of a list, equals the
+// field's example, converted with and without the field's steps or compared
+// as text.
+func matchesExample(field ExtractedSelector, value any, base *url.URL) bool {
+	if values, ok := value.([]any); ok {
+		return slices.ContainsFunc(values, func(item any) bool { return matchesExample(field, item, base) })
+	}
+	example := field.Validation.Example
+	if sameText(example, valueText(value)) {
+		return true
+	}
+	plain := field
+	plain.Steps = nil
+	for _, converter := range []ExtractedSelector{field, plain} {
+		if converted, err := converter.Convert(example, base); err == nil && reflect.DeepEqual(converted, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueText returns the text of a converted value.
+func valueText(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// valueNumber returns the number of a number or price value.
+func valueNumber(value any) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case selectors.Price:
+		return value.Amount, true
+	}
+	return 0, false
+}
+
+func sameText(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
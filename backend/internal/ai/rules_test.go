@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"selectorextractor_backend/internal/selectors"
+	"testing"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestValueRulesCheckFitsType(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     *ValueRules
+		fieldType string
+		invalid   bool
+	}{
+		{"no rules", nil, "text", false},
+		{"pattern", &ValueRules{Pattern: `^[A-Z]{2}\d+$`}, "text", false},
+		{"invalid pattern", &ValueRules{Pattern: `(?<=x)y`}, "text", true},
+		{"bounds on a number", &ValueRules{Min: float(1), Max: float(10)}, selectors.TypeNumber, false},
+		{"bounds on a price", &ValueRules{Min: float(1)}, selectors.TypePrice, false},
+		{"bounds on text", &ValueRules{Max: float(10)}, "text", true},
+		{"minimum above maximum", &ValueRules{Min: float(10), Max: float(1)}, selectors.TypeNumber, true},
+		{"pattern on a price", &ValueRules{Pattern: `^\d+`}, selectors.TypePrice, true},
+		{"allowed values of a price", &ValueRules{AllowedValues: []string{"9.99 EUR"}}, selectors.TypePrice, true},
+		{"rules on a record", &ValueRules{NonEmpty: true}, FieldTypeObject, true},
+	}
+	for _, test := range tests {
+		if err := test.rules.check(test.fieldType); (err != nil) != test.invalid {
+			t.Errorf("%s: check = %v, want invalid %v", test.name, err, test.invalid)
+		}
+	}
+}
+
+func TestValueRulesCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   *ValueRules
+		value   any
+		invalid bool
+	}{
+		{"no rules", nil, "", false},
+		{"non-empty", &ValueRules{NonEmpty: true}, "Trail Runner", false},
+		{"empty", &ValueRules{NonEmpty: true}, " ", true},
+		{"empty without nonEmpty", &ValueRules{}, "", false},
+		{"pattern matches", &ValueRules{Pattern: `^TR\d+$`}, "TR2", false},
+		{"pattern fails", &ValueRules{Pattern: `^TR\d+$`}, "Trail Runner 2", true},
+		{"pattern on a number's text", &ValueRules{Pattern: `^\d+\.\d{2}$`}, 12.99, false},
+		{"within bounds", &ValueRules{Min: float(1), Max: float(100)}, 42.0, false},
+		{"on the bounds", &ValueRules{Min: float(1), Max: float(100)}, 100.0, false},
+		{"below the minimum", &ValueRules{Min: float(1)}, 0.5, true},
+		{"above the maximum", &ValueRules{Max: float(100)}, 129.99, true},
+		{"price amount", &ValueRules{Max: float(100)}, selectors.Price{Amount: 99, Currency: "EUR"}, false},
+		{"price above the maximum", &ValueRules{Max: float(100)}, selectors.Price{Amount: 129.99, Currency: "EUR"}, true},
+		{"bounds on text", &ValueRules{Min: float(1)}, "many", true},
+		{"allowed value", &ValueRules{AllowedValues: []string{"In stock", "Sold out"}}, " in  STOCK ", false},
+		{"value not allowed", &ValueRules{AllowedValues: []string{"In stock", "Sold out"}}, "Preorder", true},
+		{"every item checked", &ValueRules{NonEmpty: true}, []any{"trail", "wide"}, false},
+		{"one item fails", &ValueRules{Pattern: `^[a-z]+$`}, []any{"trail", "Wide"}, true},
+		{"invalid pattern saved with a selector", &ValueRules{Pattern: `(`}, "x", true},
+	}
+	for _, test := range tests {
+		if err := test.rules.Check(test.value); (err != nil) != test.invalid {
+			t.Errorf("%s: Check(%v) = %v, want invalid %v", test.name, test.value, err, test.invalid)
+		}
+	}
+}
+
+func TestValueRulesCompilesPatternOnce(t *testing.T) {
+	rules := &ValueRules{Pattern: `^TR\d+$`}
+	if err := rules.check("text"); err != nil {
+		t.Fatal(err)
+	}
+	if rules.pattern == nil {
+		t.Fatal("check did not compile the pattern")
+	}
+	// Check uses the compiled pattern, not the source.
+	rules.Pattern = "("
+	if err := rules.Check("TR2"); err != nil {
+		t.Errorf("Check = %v, want the pattern compiled by check", err)
+	}
+}
+
+func TestExampleIssues(t *testing.T) {
+	field := func(fieldType, example string, steps ...selectors.Step) ExtractedSelector {
+		return ExtractedSelector{Field: "value", Type: fieldType, Steps: steps, Validation: &ValueRules{Example: example}}
+	}
+	tests := []struct {
+		name    string
+		field   ExtractedSelector
+		value   any
+		invalid bool
+	}{
+		{"same text", field("text", "Trail  Runner 2"), "trail runner 2", false},
+		{"other text", field("text", "Trail Runner 2"), "Trail Runner 3", true},
+		{"example as shown", field(selectors.TypeNumber, "1.299,00 €"), 1299.0, false},
+		{"example normalized", field(selectors.TypeNumber, "1299"), 1299.0, false},
+		{"example through steps", field(selectors.TypeNumber, "1.299", selectors.Step{Op: selectors.StepParseNumber, Arg: "de"}), 1299.0, false},
+		{"other number", field(selectors.TypeNumber, "1299"), 129.9, true},
+		{"price", field(selectors.TypePrice, "€ 129,99"), selectors.Price{Amount: 129.99, Currency: "EUR"}, false},
+		{"any item of a list", field("text", "wide"), []any{"trail", "wide"}, false},
+		{"no example", ExtractedSelector{Field: "value", Type: "text"}, "anything", false},
+	}
+	for _, test := range tests {
+		issues := exampleIssues(test.field, test.value, "value", nil)
+		if (len(issues) > 0) != test.invalid {
+			t.Errorf("%s: exampleIssues = %+v, want invalid %v", test.name, issues, test.invalid)
+		}
+	}
+}
+
+func TestExampleIssuesOfRecords(t *testing.T) {
+	size := ExtractedSelector{Field: "size", Type: "text", Validation: &ValueRules{Example: "43"}}
+	offers := ExtractedSelector{Field: "offers", Type: FieldTypeArray, Fields: []ExtractedSelector{size}}
+	records := []any{map[string]any{"size": "42"}, map[string]any{"size": "43"}}
+	if issues := exampleIssues(offers, records, "offers", nil); len(issues) != 0 {
+		t.Errorf("example found in the second item, got issues %+v", issues)
+	}
+
+	records = []any{map[string]any{"size": "42"}, map[string]any{"size": "44"}}
+	issues := exampleIssues(offers, records, "offers", nil)
+	if len(issues) != 1 || issues[0].Path != "offers.size" {
+		t.Errorf("issues = %+v, want one for offers.size", issues)
+	}
+}
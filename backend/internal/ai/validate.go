@@ -0,0 +1,182 @@
+package ai
+
+import (
+	"fmt"
+	"net/url"
+	"selectorextractor_backend/internal/selectors"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FieldValidation is the result of checking one extracted field against the
+// HTML it was generated from.
+type FieldValidation struct {
+	Field  string `json:"field"`
+	Type   string `json:"type"`
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Validator checks the selectors returned for the requested fields against the
+// HTML they were generated from. documentURL is the address of the HTML, or ""
+// if it is not known.
+type Validator func(html, documentURL string, requested []FieldToExtractSelectorsFor, fields []ExtractedSelector) []FieldValidation
+
+// ValidateFields checks that every requested field was returned and that its
+// selector and regex, or one of its fallbacks, produce a value, or at least
+// one for multi-valued fields, from the sample HTML that converts to the
+// field type and keeps the field's validation rules, including its example,
+// with links resolved against the document's <base> element or documentURL.
+// Fallbacks only need to be well-formed, as they are meant for other pages.
+// Fields solved by a function only are accepted as long as a function is
+// present.
+func ValidateFields(html, documentURL string, requested []FieldToExtractSelectorsFor, fields []ExtractedSelector) []FieldValidation {
+	doc, docErr := selectors.Parse(html)
+	var base *url.URL
+	if docErr == nil {
+		base, _ = selectors.BaseURL(doc, documentURL)
+	}
+
+	extracted := make(map[string]ExtractedSelector, len(fields))
+	for _, field := range fields {
+		extracted[field.Field] = field
+	}
+
+	results := make([]FieldValidation, 0, len(requested))
+	for _, want := range requested {
+		if field, ok := extracted[want.Name]; ok && docErr == nil && IsRecord(want.Type) {
+			results = append(results, validateRecord(doc, want, field, base)...)
+			continue
+		}
+		result := FieldValidation{Field: want.Name, Type: want.Type}
+		field, ok := extracted[want.Name]
+		switch {
+		case !ok:
+			result.Reason = "field missing from model response"
+		case docErr != nil:
+			result.Reason = fmt.Sprintf("failed to parse HTML: %v", docErr)
+		default:
+			result.Reason = validateField(doc, field, base)
+		}
+		result.Valid = result.Reason == ""
+		results = append(results, result)
+	}
+	return results
+}
+
+// validateField returns a reason why field is invalid, or "" if it is valid.
+func validateField(doc *goquery.Document, field ExtractedSelector, base *url.URL) string {
+	if field.Selector == "" {
+		if field.JavaScriptFunction == "" {
+			return "neither selector nor function provided"
+		}
+		return ""
+	}
+
+	for i, alternative := range field.Alternatives() {
+		if reason := checkRule(alternative); reason != "" {
+			if i > 0 {
+				return fmt.Sprintf("fallback %d: %s", i, reason)
+			}
+			return reason
+		}
+	}
+
+	reading, err := Read(doc.Selection, field, base)
+	if err != nil {
+		return err.Error()
+	}
+	if issues := exampleIssues(field, reading.Value, field.Field, base); len(issues) > 0 {
+		return issues[0].Reason
+	}
+	return ""
+}
+
+// validateRecord checks an object or array field and its children by reading
+// the record from doc.
+func validateRecord(doc *goquery.Document, want FieldToExtractSelectorsFor, field ExtractedSelector, base *url.URL) []FieldValidation {
+	reasons := make(map[string]string)
+	if field.Selector == "" {
+		reasons[want.Name] = "object and array fields need a selector"
+	} else {
+		value, issues := Evaluate(doc.Selection, field, base)
+		issues = append(issues, exampleIssues(field, value, want.Name, base)...)
+		for _, issue := range issues {
+			if _, ok := reasons[issue.Path]; !ok {
+				reasons[issue.Path] = issue.Reason
+			}
+		}
+	}
+
+	returned := make(map[string]bool)
+	var mark func(prefix string, fields []ExtractedSelector)
+	mark = func(prefix string, fields []ExtractedSelector) {
+		for _, child := range fields {
+			returned[prefix+child.Field] = true
+			mark(prefix+child.Field+".", child.Fields)
+		}
+	}
+	mark(want.Name+".", field.Fields)
+
+	results := []FieldValidation{{Field: want.Name, Type: want.Type, Reason: reasons[want.Name]}}
+	failedParents := make(map[string]bool)
+	if reasons[want.Name] != "" {
+		failedParents[want.Name] = true
+	}
+	invalidChildren := 0
+	walkFields(want.Fields, want.Name+".", func(path string, child FieldToExtractSelectorsFor) {
+		result := FieldValidation{Field: path, Type: child.Type}
+		parent := path[:strings.LastIndex(path, ".")]
+		switch {
+		case failedParents[parent]:
+			result.Reason = fmt.Sprintf("parent field %q is invalid", parent)
+		case !returned[path]:
+			result.Reason = "field missing from model response"
+		default:
+			result.Reason = reasons[path]
+		}
+		if result.Reason != "" {
+			failedParents[path] = true
+			invalidChildren++
+		}
+		result.Valid = result.Reason == ""
+		results = append(results, result)
+	})
+
+	if results[0].Reason == "" && invalidChildren > 0 {
+		results[0].Reason = fmt.Sprintf("invalid child fields: %d", invalidChildren)
+	}
+	results[0].Valid = results[0].Reason == ""
+	return results
+}
+
+// invalidFieldsError fails an extraction attempt whose fields do not pass
+// validation.
+type invalidFieldsError struct {
+	fields []FieldValidation
+}
+
+func (e *invalidFieldsError) Error() string {
+	reasons := make([]string, 0, len(e.fields))
+	for _, field := range e.fields {
+		reasons = append(reasons, field.Field+": "+field.Reason)
+	}
+	return fmt.Sprintf("%d fields failed validation: %s", len(e.fields), strings.Join(reasons, "; "))
+}
+
+// markValidity sets Valid and Reason of fields and their children from the
+// validation results, which name child fields by their path.
+func markValidity(fields []ExtractedSelector, prefix string, validations []FieldValidation) {
+	for i := range fields {
+		field := &fields[i]
+		path := prefix + field.Field
+		for _, validation := range validations {
+			if validation.Field == path {
+				field.Valid, field.Reason = validation.Valid, validation.Reason
+				break
+			}
+		}
+		markValidity(field.Fields, path+".", validations)
+	}
+}
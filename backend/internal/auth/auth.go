@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/quota"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var ErrUnauthorized = errors.New("invalid or missing client token")
+
+const clientContextKey = "auth.client"
+
+// Client is an authenticated caller of the API.
+type Client struct {
+	ID            string       `json:"id"`
+	AllowedModels []string     `json:"allowedModels,omitempty"`
+	Quota         quota.Limits `json:"quota"`
+}
+
+// AllowsModel reports whether the client may use the given model. An empty
+// allow-list permits every model.
+func (c *Client) AllowsModel(model string) bool {
+	if len(c.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedModels {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenEntry is one record of the tokens file. Either Token or TokenSHA256 must be set.
+type tokenEntry struct {
+	Client
+	Token       string `json:"token,omitempty"`
+	TokenSHA256 string `json:"tokenSha256,omitempty"`
+}
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Models []string     `json:"models,omitempty"`
+	Quota  quota.Limits `json:"quota"`
+}
+
+// Authenticator resolves bearer credentials into clients. It accepts static API
+// tokens loaded from a file and HS256 JWTs signed with the configured secret.
+type Authenticator struct {
+	tokens    map[string]*Client
+	jwtSecret []byte
+}
+
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens:    make(map[string]*Client),
+		jwtSecret: []byte(cfg.JWTSecret),
+	}
+
+	if cfg.TokensFile != "" {
+		data, err := os.ReadFile(cfg.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tokens file: %w", err)
+		}
+		var entries []tokenEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse tokens file: %w", err)
+		}
+		for _, entry := range entries {
+			hash := strings.ToLower(entry.TokenSHA256)
+			if entry.Token != "" {
+				hash = hashToken(entry.Token)
+			}
+			if hash == "" || entry.ID == "" {
+				return nil, fmt.Errorf("tokens file entry %q needs an id and a token or tokenSha256", entry.ID)
+			}
+			client := entry.Client
+			a.tokens[hash] = &client
+		}
+	}
+
+	if len(a.tokens) == 0 && len(a.jwtSecret) == 0 {
+		return nil, fmt.Errorf("server auth mode requires AUTH_TOKENS_FILE or AUTH_JWT_SECRET")
+	}
+
+	return a, nil
+}
+
+// Authenticate resolves a bearer credential into a client.
+func (a *Authenticator) Authenticate(credential string) (*Client, error) {
+	if credential == "" {
+		return nil, ErrUnauthorized
+	}
+
+	// Tokens are stored and looked up by their SHA-256 hash only.
+	if client, ok := a.tokens[hashToken(credential)]; ok {
+		return client, nil
+	}
+
+	if len(a.jwtSecret) == 0 || strings.Count(credential, ".") != 2 {
+		return nil, ErrUnauthorized
+	}
+
+	var claims jwtClaims
+	_, err := jwt.ParseWithClaims(credential, &claims, func(token *jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" {
+		return nil, ErrUnauthorized
+	}
+
+	return &Client{
+		ID:            claims.Subject,
+		AllowedModels: claims.Models,
+		Quota:         claims.Quota,
+	}, nil
+}
+
+// SetClient stores the authenticated client on the request context.
+func SetClient(c echo.Context, client *Client) {
+	c.Set(clientContextKey, client)
+}
+
+// GetClient returns the authenticated client, or nil when the request was not
+// authenticated by the server.
+func GetClient(c echo.Context) *Client {
+	client, _ := c.Get(clientContextKey).(*Client)
+	return client
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
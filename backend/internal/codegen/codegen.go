@@ -0,0 +1,245 @@
+// Package codegen writes the extraction functions of rules the model does not
+// write itself. Rules reading JSON-LD or embedded application state are
+// turned into JavaScript, TypeScript, Python and Go functions that follow the
+// same steps as selectors.Apply.
+package codegen
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"selectorextractor_backend/internal/jsonpath"
+	"selectorextractor_backend/internal/selectors"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").ParseFS(templateFS, "templates/*.tmpl"))
+
+// Functions holds the generated function of a rule in each supported
+// language, with the same signatures the model is asked for.
+type Functions struct {
+	JavaScript string
+	TypeScript string
+	Python     string
+	Go         string
+}
+
+// language renders the parts of a function that differ between languages.
+type language struct {
+	template string
+	quote    func(string) string
+	literal  func(any) string
+	member   func(key string) string
+	index    func(index int) string
+	filter   func(path []string, op string, literal string) string
+}
+
+// templateData is the data available to the function templates.
+type templateData struct {
+	JSONLD bool
+	// Multiple makes the function return every value instead of the first.
+	Multiple bool
+	Selector string
+	// Steps are the rendered statements narrowing down values, one per
+	// accessor of the JSON path, each with its indentation and line break.
+	Steps      []string
+	UsesMember bool
+	UsesIndex  bool
+	UsesFilter bool
+	Regex      string
+	RegexUse   string
+	RegexIndex int
+	// AssignmentPattern is selectors.AssignmentPattern quoted for Go.
+	AssignmentPattern string
+}
+
+// ForRule returns the functions for rule, or false if the rule is not read
+// from JSON or uses JSON path features the functions do not implement. With
+// multiple the functions return lists, as selectors.ApplyAll does.
+func ForRule(rule selectors.Rule, multiple bool) (Functions, bool) {
+	if rule.ExtractMethod != selectors.ExtractMethodJSONLD && rule.ExtractMethod != selectors.ExtractMethodJSON {
+		return Functions{}, false
+	}
+	compiled, err := jsonpath.Compile(rule.JSONPath)
+	if err != nil {
+		return Functions{}, false
+	}
+	accessors, ok := compiled.Accessors()
+	if !ok || len(accessors) == 0 {
+		return Functions{}, false
+	}
+	switch rule.RegexUse {
+	case "", "extract", "omit":
+	default:
+		return Functions{}, false
+	}
+	if rule.Regex != "" {
+		if _, err := selectors.CompileRegex(rule.Regex); err != nil {
+			return Functions{}, false
+		}
+	}
+
+	var (
+		functions Functions
+		outputs   = []*string{&functions.JavaScript, &functions.TypeScript, &functions.Python, &functions.Go}
+	)
+	for i, lang := range []language{javaScript, typeScript, python, golang} {
+		code, err := render(lang, rule, multiple, accessors)
+		if err != nil {
+			return Functions{}, false
+		}
+		*outputs[i] = code
+	}
+	return functions, true
+}
+
+func render(lang language, rule selectors.Rule, multiple bool, accessors []jsonpath.Accessor) (string, error) {
+	data := templateData{
+		JSONLD:            rule.ExtractMethod == selectors.ExtractMethodJSONLD,
+		Multiple:          multiple,
+		Selector:          lang.quote(rule.Selector),
+		RegexUse:          rule.RegexUse,
+		RegexIndex:        rule.RegexMatchIndexToUse,
+		AssignmentPattern: strconv.Quote(selectors.AssignmentPattern),
+	}
+	if rule.Regex != "" {
+		data.Regex = lang.quote(rule.Regex)
+	}
+	for _, accessor := range accessors {
+		switch {
+		case accessor.IsFilter:
+			data.UsesFilter = true
+			data.Steps = append(data.Steps, lang.filter(accessor.FilterPath, accessor.FilterOp, lang.literal(accessor.FilterLiteral)))
+		case accessor.IsIndex:
+			data.UsesIndex = true
+			data.Steps = append(data.Steps, lang.index(accessor.Index))
+		default:
+			data.UsesMember = true
+			data.Steps = append(data.Steps, lang.member(accessor.Member))
+		}
+	}
+
+	var b strings.Builder
+	if err := templates.ExecuteTemplate(&b, lang.template, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", lang.template, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// jsonString quotes s as a JSON string, which JavaScript, TypeScript and
+// Python read as the same string.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func jsonLiteral(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func jsonStrings(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, jsonString(value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+var javaScript = language{
+	template: "javascript.tmpl",
+	quote:    jsonString,
+	literal:  jsonLiteral,
+	member: func(key string) string {
+		return fmt.Sprintf("      values = values.flatMap((v) => member(v, %s));\n", jsonString(key))
+	},
+	index: func(index int) string {
+		return fmt.Sprintf("      values = values.flatMap((v) => index(v, %d));\n", index)
+	},
+	filter: func(path []string, op string, literal string) string {
+		return fmt.Sprintf("      values = values.flatMap((v) => children(v).filter((c) => matches(dig(c, %s), %s, %s)));\n", jsonStrings(path), jsonString(op), literal)
+	},
+}
+
+var typeScript = language{
+	template: "typescript.tmpl",
+	quote:    jsonString,
+	literal:  jsonLiteral,
+	member:   javaScript.member,
+	index:    javaScript.index,
+	filter:   javaScript.filter,
+}
+
+var python = language{
+	template: "python.tmpl",
+	quote:    jsonString,
+	literal: func(value any) string {
+		switch value := value.(type) {
+		case nil:
+			return "None"
+		case bool:
+			if value {
+				return "True"
+			}
+			return "False"
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		return jsonLiteral(value)
+	},
+	member: func(key string) string {
+		return fmt.Sprintf("            values = [x for v in values for x in member(v, %s)]\n", jsonString(key))
+	},
+	index: func(index int) string {
+		return fmt.Sprintf("            values = [x for v in values for x in index(v, %d)]\n", index)
+	},
+	filter: func(path []string, op string, literal string) string {
+		return fmt.Sprintf("            values = [c for v in values for c in children(v) if matches(dig(c, %s), %s, %s)]\n", jsonStrings(path), jsonString(op), literal)
+	},
+}
+
+var golang = language{
+	template: "go.tmpl",
+	quote:    strconv.Quote,
+	literal: func(value any) string {
+		switch value := value.(type) {
+		case nil:
+			return "nil"
+		case bool:
+			return strconv.FormatBool(value)
+		case float64:
+			// Decoded JSON numbers are float64, so the literal must be too.
+			return "float64(" + strconv.FormatFloat(value, 'f', -1, 64) + ")"
+		case string:
+			return strconv.Quote(value)
+		}
+		return "nil"
+	},
+	member: func(key string) string {
+		return fmt.Sprintf("\t\tvalues = flatMap(values, func(v any) []any { return member(v, %s) })\n", strconv.Quote(key))
+	},
+	index: func(index int) string {
+		return fmt.Sprintf("\t\tvalues = flatMap(values, func(v any) []any { return index(v, %d) })\n", index)
+	},
+	filter: func(path []string, op string, literal string) string {
+		args := []string{"c"}
+		for _, key := range path {
+			args = append(args, strconv.Quote(key))
+		}
+		return fmt.Sprintf(`		values = flatMap(values, func(v any) []any {
+			var kept []any
+			for _, c := range children(v) {
+				if matches(dig(%s), %s, %s) {
+					kept = append(kept, c)
+				}
+			}
+			return kept
+		})
+`, strings.Join(args, ", "), strconv.Quote(op), literal)
+	},
+}
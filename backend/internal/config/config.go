@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,6 +11,9 @@ type Config struct {
 	Server   ServerConfig
 	Security SecurityConfig
 	AI       AIConfig
+	Fetch    FetchConfig
+	Log      LogConfig
+	Tracing  TracingConfig
 }
 
 type ServerConfig struct {
@@ -17,45 +21,155 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// BatchTimeout replaces WriteTimeout for batch extraction, which makes up
+	// to extractor.BatchRounds extractions one after another.
+	BatchTimeout time.Duration
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header is believed. Without any, the client IP is the
+	// address of the connection.
+	TrustedProxies []string
 }
 
 type SecurityConfig struct {
 	AllowedOrigins []string
 	RateLimit      RateLimitConfig
+	Auth           AuthConfig
+}
+
+const (
+	// AuthModeClientKey lets every client send its own OpenRouter key in X-API-Key.
+	AuthModeClientKey = "client-key"
+	// AuthModeServer keeps provider keys on the server and authenticates clients
+	// with server-issued API tokens or JWTs.
+	AuthModeServer = "server"
+)
+
+type AuthConfig struct {
+	Mode       string
+	TokensFile string
+	JWTSecret  string
 }
 
 type RateLimitConfig struct {
 	Enabled bool
-	Limit   int
-	Window  time.Duration
+	// Limit is the number of requests allowed per Window for a single client.
+	Limit  int
+	Window time.Duration
+	Burst  int
+	// IdleTTL is how long an unused client bucket is kept before it is dropped.
+	IdleTTL time.Duration
+	// Routes overrides Limit for individual route paths, e.g. "/api/v1/extract".
+	Routes map[string]int
+	// FailedAuthLimit is the number of rejected credentials allowed per Window
+	// for a single IP before authentication is refused.
+	FailedAuthLimit int
 }
 
 type AIConfig struct {
-	OpenRouterAPIKey string
-	DefaultModel     string
-	MaxTokens        int
-	Temperature      float32
+	// Provider is "openrouter", "record", "replay" or "fake".
+	Provider          string
+	RecordingsDir     string
+	FakeScript        string
+	OpenRouterAPIKeys []string
+	KeyCooldown       time.Duration
+	DefaultModel      string
+	MaxTokens         int
+	Temperature       float32
+	PromptVersion     string
+	// CleanerProfile is "default", "minimal" or "none".
+	CleanerProfile string
+}
+
+// FetchConfig controls how pages are fetched for requests that give a URL
+// instead of HTML.
+type FetchConfig struct {
+	Timeout      time.Duration
+	MaxBytes     int
+	MaxRedirects int
+	UserAgent    string
+	// Headers are sent with every fetch, e.g. "Accept-Language=de-DE".
+	Headers map[string]string
+	// Cookies is sent as the Cookie header, e.g. "consent=1; region=eu".
+	Cookies       string
+	RespectRobots bool
+	// AllowPrivateNetworks disables the SSRF guard. Only for local testing.
+	AllowPrivateNetworks bool
+}
+
+type LogConfig struct {
+	Level      string
+	Format     string
+	Dir        string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+type TracingConfig struct {
+	// Exporter is "otlp", "stdout" or empty to disable tracing.
+	Exporter    string
+	ServiceName string
+	SampleRatio float64
 }
 
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnvOrDefault("PORT", "1323"),
-			ReadTimeout:  getDurationEnvOrDefault("READ_TIMEOUT", 15*time.Second),
-			WriteTimeout: getDurationEnvOrDefault("WRITE_TIMEOUT", 15*time.Second),
+			Port:           getEnvOrDefault("PORT", "1323"),
+			ReadTimeout:    getDurationEnvOrDefault("READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:   getDurationEnvOrDefault("WRITE_TIMEOUT", 15*time.Second),
+			BatchTimeout:   getDurationEnvOrDefault("BATCH_TIMEOUT", 5*time.Minute),
+			TrustedProxies: getSliceEnvOrDefault("TRUSTED_PROXIES", nil),
 		},
 		Security: SecurityConfig{
 			AllowedOrigins: getSliceEnvOrDefault("ALLOWED_ORIGINS", []string{"*"}),
 			RateLimit: RateLimitConfig{
-				Enabled: getBoolEnvOrDefault("RATE_LIMIT_ENABLED", true),
-				Limit:   getIntEnvOrDefault("RATE_LIMIT", 100),
-				Window:  getDurationEnvOrDefault("RATE_LIMIT_WINDOW", time.Minute),
+				Enabled:         getBoolEnvOrDefault("RATE_LIMIT_ENABLED", true),
+				Limit:           getIntEnvOrDefault("RATE_LIMIT", 100),
+				Window:          getDurationEnvOrDefault("RATE_LIMIT_WINDOW", time.Minute),
+				Burst:           getIntEnvOrDefault("RATE_LIMIT_BURST", 0),
+				IdleTTL:         getDurationEnvOrDefault("RATE_LIMIT_IDLE_TTL", 10*time.Minute),
+				Routes:          getIntMapEnvOrDefault("RATE_LIMIT_ROUTES", nil),
+				FailedAuthLimit: getIntEnvOrDefault("RATE_LIMIT_FAILED_AUTH", 10),
+			},
+			Auth: AuthConfig{
+				Mode:       getEnvOrDefault("AUTH_MODE", AuthModeClientKey),
+				TokensFile: getEnvOrDefault("AUTH_TOKENS_FILE", ""),
+				JWTSecret:  getEnvOrDefault("AUTH_JWT_SECRET", ""),
 			},
 		},
 		AI: AIConfig{
-			DefaultModel: getEnvOrDefault("DEFAULT_MODEL", "x-ai/grok-3-mini"),
-			MaxTokens:    getIntEnvOrDefault("MAX_TOKENS", 8192),
-			Temperature:  getFloatEnvOrDefault("TEMPERATURE", 0.4),
+			Provider:          getEnvOrDefault("AI_PROVIDER", "openrouter"),
+			RecordingsDir:     getEnvOrDefault("AI_RECORDINGS_DIR", "testdata/recordings"),
+			FakeScript:        getEnvOrDefault("AI_FAKE_SCRIPT", ""),
+			OpenRouterAPIKeys: getSliceEnvOrDefault("OPENROUTER_API_KEYS", getSliceEnvOrDefault("OPENROUTER_API_KEY", nil)),
+			KeyCooldown:       getDurationEnvOrDefault("OPENROUTER_KEY_COOLDOWN", time.Minute),
+			DefaultModel:      getEnvOrDefault("DEFAULT_MODEL", "x-ai/grok-3-mini"),
+			MaxTokens:         getIntEnvOrDefault("MAX_TOKENS", 8192),
+			Temperature:       getFloatEnvOrDefault("TEMPERATURE", 0.4),
+			PromptVersion:     getEnvOrDefault("PROMPT_VERSION", ""),
+			CleanerProfile:    getEnvOrDefault("CLEANER_PROFILE", "default"),
+		},
+		Fetch: FetchConfig{
+			Timeout:              getDurationEnvOrDefault("FETCH_TIMEOUT", 15*time.Second),
+			MaxBytes:             getIntEnvOrDefault("FETCH_MAX_BYTES", 5<<20),
+			MaxRedirects:         getIntEnvOrDefault("FETCH_MAX_REDIRECTS", 5),
+			UserAgent:            getEnvOrDefault("FETCH_USER_AGENT", "selectorextractor/1.0 (+https://github.com/sstehniy/selectorextractor)"),
+			Headers:              getStringMapEnvOrDefault("FETCH_HEADERS", nil),
+			Cookies:              getEnvOrDefault("FETCH_COOKIES", ""),
+			RespectRobots:        getBoolEnvOrDefault("FETCH_RESPECT_ROBOTS", true),
+			AllowPrivateNetworks: getBoolEnvOrDefault("FETCH_ALLOW_PRIVATE_NETWORKS", false),
+		},
+		Log: LogConfig{
+			Level:      getEnvOrDefault("LOG_LEVEL", "info"),
+			Format:     getEnvOrDefault("LOG_FORMAT", "json"),
+			Dir:        getEnvOrDefault("LOG_DIR", "logs"),
+			MaxSizeMB:  getIntEnvOrDefault("LOG_MAX_SIZE_MB", 50),
+			MaxBackups: getIntEnvOrDefault("LOG_MAX_BACKUPS", 5),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnvOrDefault("TRACING_EXPORTER", ""),
+			ServiceName: getEnvOrDefault("OTEL_SERVICE_NAME", "selectorextractor-backend"),
+			SampleRatio: float64(getFloatEnvOrDefault("TRACING_SAMPLE_RATIO", 1)),
 		},
 	}
 }
@@ -105,7 +219,49 @@ func getDurationEnvOrDefault(key string, defaultValue time.Duration) time.Durati
 
 func getSliceEnvOrDefault(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
-		return []string{value}
+		var values []string
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+		if len(values) > 0 {
+			return values
+		}
 	}
 	return defaultValue
 }
+
+// getIntMapEnvOrDefault parses values of the form "key=1,other=2".
+func getIntMapEnvOrDefault(key string, defaultValue map[string]int) map[string]int {
+	entries := getSliceEnvOrDefault(key, nil)
+	if len(entries) == 0 {
+		return defaultValue
+	}
+	values := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		name, rawValue, found := strings.Cut(entry, "=")
+		if !found {
+			continue
+		}
+		if intValue, err := strconv.Atoi(strings.TrimSpace(rawValue)); err == nil {
+			values[strings.TrimSpace(name)] = intValue
+		}
+	}
+	return values
+}
+
+// getStringMapEnvOrDefault parses values of the form "key=value,other=value".
+func getStringMapEnvOrDefault(key string, defaultValue map[string]string) map[string]string {
+	entries := getSliceEnvOrDefault(key, nil)
+	if len(entries) == 0 {
+		return defaultValue
+	}
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if name, value, found := strings.Cut(entry, "="); found {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
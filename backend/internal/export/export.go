@@ -0,0 +1,174 @@
+// Package export writes batch results as CSV, JSON Lines or CSV that Excel
+// opens without an import dialog.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"selectorextractor_backend/pkg/extractor"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatJSONL    = "jsonl"
+	FormatExcelCSV = "xlsx-csv"
+)
+
+// IsFormat reports whether format is one of the supported formats.
+func IsFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatCSV, FormatJSONL, FormatExcelCSV:
+		return true
+	}
+	return false
+}
+
+// ContentType returns the MIME type and file extension of format.
+func ContentType(format string) (string, string) {
+	switch format {
+	case FormatCSV, FormatExcelCSV:
+		return "text/csv; charset=utf-8", "csv"
+	case FormatJSONL:
+		return "application/x-ndjson", "jsonl"
+	default:
+		return "application/json", "json"
+	}
+}
+
+// WriteRows writes one row per document with a column per field in the
+// order of fields. FormatJSON is handled by the caller's response envelope
+// and is not accepted here.
+func WriteRows(w io.Writer, format string, fields []string, rows []extractor.BatchRow) error {
+	switch format {
+	case FormatJSONL:
+		return writeJSONL(w, fields, rows)
+	case FormatCSV:
+		return writeCSV(w, fields, rows, false)
+	case FormatExcelCSV:
+		return writeCSV(w, fields, rows, true)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// jsonlRow is the flat form of a BatchRow: values and errors keyed by field.
+type jsonlRow struct {
+	Document string            `json:"document"`
+	Success  bool              `json:"success"`
+	Error    string            `json:"error,omitempty"`
+	Values   map[string]any    `json:"values"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+func writeJSONL(w io.Writer, fields []string, rows []extractor.BatchRow) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		line := jsonlRow{
+			Document: row.Document,
+			Success:  row.Success,
+			Error:    row.Error,
+			Values:   make(map[string]any, len(fields)),
+		}
+		for _, value := range row.Values {
+			line.Values[value.Field] = value.Value
+			if value.Error != "" {
+				if line.Errors == nil {
+					line.Errors = make(map[string]string)
+				}
+				line.Errors[value.Field] = value.Error
+			}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes a header and one record per row. For Excel the output
+// starts with a UTF-8 byte order mark, uses CRLF line endings and prefixes
+// cells that Excel would evaluate as formulas, other than plain numbers, with
+// a quote.
+func writeCSV(w io.Writer, fields []string, rows []extractor.BatchRow, excel bool) error {
+	if excel {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = excel
+
+	cell := func(s string) string {
+		if excel && s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return "'" + s
+			}
+		}
+		return s
+	}
+
+	header := append([]string{"document", "success"}, fields...)
+	header = append(header, "errors")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		values := make(map[string]extractor.Value, len(row.Values))
+		for _, value := range row.Values {
+			values[value.Field] = value
+		}
+
+		record := []string{cell(row.Document), strconv.FormatBool(row.Success)}
+		var errors []string
+		if row.Error != "" {
+			errors = append(errors, row.Error)
+		}
+		for _, field := range fields {
+			value := values[field]
+			record = append(record, cell(formatValue(value.Value)))
+			if value.Error != "" {
+				errors = append(errors, field+": "+value.Error)
+			}
+		}
+		record = append(record, cell(strings.Join(errors, "; ")))
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatValue renders a value for a CSV cell. The values of multi-valued
+// fields go on separate lines of the cell, records are written as JSON.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		lines := make([]string, 0, len(v))
+		for _, element := range v {
+			lines = append(lines, formatValue(element))
+		}
+		return strings.Join(lines, "\n")
+	case map[string]any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,287 @@
+// Package fetch downloads pages for requests that give a URL instead of HTML.
+// Every connection, including those of redirects, is checked against a list of
+// non-public address ranges so that a request cannot reach the server's own
+// network.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/ingest"
+	"selectorextractor_backend/internal/tracing"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrBlockedAddress     = errors.New("address is not publicly routable")
+	ErrUnsupportedScheme  = errors.New("only http and https URLs can be fetched")
+	ErrTooManyRedirects   = errors.New("too many redirects")
+	ErrTooLarge           = errors.New("response exceeds the size limit")
+	ErrDisallowedByRobots = errors.New("fetching is disallowed by robots.txt")
+	ErrUnsupportedContent = errors.New("response is not an HTML document")
+	ErrStatus             = errors.New("unexpected response status")
+)
+
+// blockedPrefixes are special-purpose ranges that netip does not classify as
+// private, loopback or link-local.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	// 6to4 and Teredo addresses embed IPv4 addresses, which may be private.
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("2001::/32"),
+}
+
+// Options are per-request additions to the configured headers and cookies.
+type Options struct {
+	Headers   map[string]string `json:"headers,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+	Cookies   string            `json:"cookies,omitempty"`
+}
+
+// Page is a fetched document transcoded to UTF-8.
+type Page struct {
+	// URL is the address after redirects.
+	URL         string
+	HTML        string
+	ContentType string
+	Charset     string
+}
+
+type Fetcher struct {
+	cfg    config.FetchConfig
+	client *http.Client
+	robots *robotsCache
+	// checkDial is called with the resolved address of every connection, or
+	// is nil if connections are not checked.
+	checkDial func(address string) error
+}
+
+func New(cfg config.FetchConfig) *Fetcher {
+	f := &Fetcher{cfg: cfg, robots: newRobotsCache()}
+	if !cfg.AllowPrivateNetworks {
+		f.checkDial = checkAddress
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if f.checkDial == nil {
+				return nil
+			}
+			return f.checkDial(address)
+		},
+	}
+	f.client = &http.Client{
+		Transport: &http.Transport{
+			// A proxy would make the dialer check the proxy's address instead
+			// of the target's.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+// checkAddress rejects the resolved address of a connection if it is not
+// publicly routable.
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+		}
+	}
+	return nil
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= f.cfg.MaxRedirects {
+		return ErrTooManyRedirects
+	}
+	if err := checkScheme(req.URL); err != nil {
+		return err
+	}
+	// robots.txt requests are not subject to robots.txt themselves.
+	if f.cfg.RespectRobots && via[0].URL.Path != robotsPath {
+		allowed, err := f.robots.allowed(req.Context(), f.client, req.URL, req.Header.Get("User-Agent"))
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrDisallowedByRobots
+		}
+	}
+	return nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	return nil
+}
+
+// Fetch downloads rawURL and returns it as UTF-8 HTML. It fails for
+// non-public addresses, pages disallowed by robots.txt, error statuses,
+// non-HTML content and responses larger than the configured limit.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, opts Options) (*Page, error) {
+	ctx, span := tracing.Start(ctx, "fetch.Fetch")
+	defer span.End()
+
+	page, err := f.fetch(ctx, rawURL, opts)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.String("url.host", hostOf(page.URL)),
+		attribute.String("charset", page.Charset),
+		attribute.Int("html.size", len(page.HTML)),
+	)
+	return page, nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string, opts Options) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	userAgent := f.cfg.UserAgent
+	if opts.UserAgent != "" {
+		userAgent = opts.UserAgent
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	if f.cfg.RespectRobots {
+		allowed, err := f.robots.allowed(ctx, f.client, u, userAgent)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrDisallowedByRobots
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	for name, value := range f.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if cookies := joinCookies(f.cfg.Cookies, opts.Cookies); cookies != "" {
+		req.Header.Set("Cookie", cookies)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isHTML(contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContent, contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(f.cfg.MaxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > f.cfg.MaxBytes {
+		return nil, fmt.Errorf("%w of %d bytes", ErrTooLarge, f.cfg.MaxBytes)
+	}
+
+	html, charset, err := ingest.Decode(body, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{
+		URL:         resp.Request.URL.String(),
+		HTML:        html,
+		ContentType: contentType,
+		Charset:     charset,
+	}, nil
+}
+
+// isHTML accepts HTML and XHTML as well as responses without a content type.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func joinCookies(cookies ...string) string {
+	var parts []string
+	for _, c := range cookies {
+		if c = strings.TrimSpace(c); c != "" {
+			parts = append(parts, c)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"selectorextractor_backend/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig() config.FetchConfig {
+	return config.FetchConfig{
+		Timeout:      5 * time.Second,
+		MaxBytes:     1024,
+		MaxRedirects: 3,
+		UserAgent:    "selectorextractor/1.0",
+	}
+}
+
+// newTestFetcher returns a fetcher that checks every address except that of
+// server, so that server stands in for a public host.
+func newTestFetcher(cfg config.FetchConfig, server *httptest.Server) *Fetcher {
+	f := New(cfg)
+	allowed := server.Listener.Addr().String()
+	f.checkDial = func(address string) error {
+		if address == allowed {
+			return nil
+		}
+		return checkAddress(address)
+	}
+	return f
+}
+
+func serveHTML(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.215.14:80", false},
+		{"[2606:4700::1111]:443", false},
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:80", true},
+		{"172.16.0.1:80", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"100.64.0.1:80", true},
+		{"0.0.0.0:80", true},
+		{"[::1]:80", true},
+		{"[fd00::1]:80", true},
+		{"[fe80::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"[64:ff9b::a00:1]:80", true},
+		{"[2002:a00:1::1]:80", true},
+		{"[2001:0:4136:e378::1]:80", true},
+	}
+	for _, test := range tests {
+		err := checkAddress(test.address)
+		if blocked := errors.Is(err, ErrBlockedAddress); blocked != test.blocked {
+			t.Errorf("checkAddress(%q) = %v, want blocked %v", test.address, err, test.blocked)
+		}
+	}
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(serveHTML("<p>internal</p>"))
+	defer server.Close()
+
+	f := New(testConfig())
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	for _, rawURL := range []string{server.URL, "http://localhost:" + port + "/"} {
+		_, err := f.Fetch(context.Background(), rawURL, Options{})
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Fetch(%q) = %v, want %v", rawURL, err, ErrBlockedAddress)
+		}
+	}
+}
+
+func TestFetchAllowPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(serveHTML("<p>local</p>"))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.AllowPrivateNetworks = true
+	page, err := New(cfg).Fetch(context.Background(), server.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page.HTML, "local") {
+		t.Errorf("HTML = %q, want the page", page.HTML)
+	}
+}
+
+func TestFetchBlocksRedirectToPrivateHost(t *testing.T) {
+	internal := httptest.NewServer(serveHTML("<p>internal</p>"))
+	defer internal.Close()
+	server := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer server.Close()
+
+	_, err := newTestFetcher(testConfig(), server).Fetch(context.Background(), server.URL, Options{})
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch = %v, want %v", err, ErrBlockedAddress)
+	}
+}
+
+func TestFetchRejectsUnsupportedScheme(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("file:///etc/passwd", http.StatusFound))
+	defer server.Close()
+
+	f := newTestFetcher(testConfig(), server)
+	for _, rawURL := range []string{"file:///etc/passwd", "ftp://example.com/", server.URL} {
+		_, err := f.Fetch(context.Background(), rawURL, Options{})
+		if !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("Fetch(%q) = %v, want %v", rawURL, err, ErrUnsupportedScheme)
+		}
+	}
+}
+
+func TestFetchMaxRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher(testConfig(), server).Fetch(context.Background(), server.URL+"/", Options{})
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Fetch = %v, want %v", err, ErrTooManyRedirects)
+	}
+}
+
+func TestFetchMaxBytes(t *testing.T) {
+	cfg := testConfig()
+	for size, want := range map[int]error{
+		cfg.MaxBytes:     nil,
+		cfg.MaxBytes + 1: ErrTooLarge,
+	} {
+		server := httptest.NewServer(serveHTML(strings.Repeat("a", size)))
+		_, err := newTestFetcher(cfg, server).Fetch(context.Background(), server.URL, Options{})
+		server.Close()
+		if !errors.Is(err, want) {
+			t.Errorf("Fetch of %d bytes = %v, want %v", size, err, want)
+		}
+	}
+}
+
+func TestFetchRespectsRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	})
+	mux.HandleFunc("/", serveHTML("<p>page</p>"))
+	mux.Handle("/moved", http.RedirectHandler("/private/page", http.StatusFound))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.RespectRobots = true
+	f := newTestFetcher(cfg, server)
+	for path, want := range map[string]error{
+		"/public":       nil,
+		"/private/page": ErrDisallowedByRobots,
+		"/moved":        ErrDisallowedByRobots,
+	} {
+		_, err := f.Fetch(context.Background(), server.URL+path, Options{})
+		if !errors.Is(err, want) {
+			t.Errorf("Fetch(%q) = %v, want %v", path, err, want)
+		}
+	}
+}
+
+func TestRobotsCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newRobotsCache()
+	c.maxEntries = 2
+	c.put(&robotsEntry{key: "a", expires: time.Now().Add(time.Hour)})
+	c.put(&robotsEntry{key: "b", expires: time.Now().Add(time.Hour)})
+	c.get("a")
+	c.put(&robotsEntry{key: "c", expires: time.Now().Add(time.Hour)})
+	c.put(&robotsEntry{key: "d", expires: time.Now().Add(-time.Second)})
+
+	for key, want := range map[string]bool{"a": false, "b": false, "c": true, "d": false} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%q) found = %v, want %v", key, ok, want)
+		}
+	}
+	if len(c.entries) != 1 || c.recent.Len() != 1 {
+		t.Errorf("cache holds %d entries, want 1", len(c.entries))
+	}
+}
+
+func TestPageURLAfterRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.HandleFunc("/new", serveHTML("<p>new</p>"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	page, err := newTestFetcher(testConfig(), server).Fetch(context.Background(), server.URL+"/old", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(page.URL); u.Path != "/new" {
+		t.Errorf("URL = %q, want the redirect target", page.URL)
+	}
+}
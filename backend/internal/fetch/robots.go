@@ -0,0 +1,229 @@
+package fetch
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	robotsPath     = "/robots.txt"
+	robotsTTL      = time.Hour
+	robotsMaxBytes = 500 << 10
+	// robotsMaxEntries bounds the cache, as callers choose both the hosts
+	// and the user agent of the key.
+	robotsMaxEntries = 1000
+)
+
+// robotsRule is an Allow or Disallow line of the group that applies to us.
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsEntry struct {
+	key     string
+	rules   []robotsRule
+	expires time.Time
+}
+
+// robotsCache keeps the parsed robots.txt rules per origin and user agent for
+// robotsTTL, dropping the least recently used entry beyond maxEntries.
+type robotsCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{
+		maxEntries: robotsMaxEntries,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// get returns the unexpired entry for key and marks it as recently used.
+func (c *robotsCache) get(key string) (*robotsEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*robotsEntry)
+	if time.Now().After(entry.expires) {
+		c.recent.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return entry, true
+}
+
+func (c *robotsCache) put(entry *robotsEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[entry.key] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*robotsEntry).key)
+	}
+}
+
+// allowed reports whether robots.txt of u's origin allows userAgent to fetch
+// u. A missing robots.txt allows everything; one that cannot be fetched
+// because of a server or network error disallows everything, as RFC 9309
+// asks. Blocked addresses and cancelled requests are returned as errors.
+func (c *robotsCache) allowed(ctx context.Context, client *http.Client, u *url.URL, userAgent string) (bool, error) {
+	token := productToken(userAgent)
+	key := u.Scheme + "://" + u.Host + " " + token
+
+	entry, ok := c.get(key)
+	if !ok {
+		rules, err := loadRobots(ctx, client, u, userAgent, token)
+		if err != nil {
+			return false, err
+		}
+		entry = &robotsEntry{key: key, rules: rules, expires: time.Now().Add(robotsTTL)}
+		c.put(entry)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	// The longest matching rule wins; Allow wins ties.
+	allow, length := true, -1
+	for _, rule := range entry.rules {
+		if rule.pattern.MatchString(path) && (rule.length > length || rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow, nil
+}
+
+func loadRobots(ctx context.Context, client *http.Client, u *url.URL, userAgent, token string) ([]robotsRule, error) {
+	disallowAll := []robotsRule{{allow: false, length: 0, pattern: regexp.MustCompile(`^`)}}
+
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: robotsPath}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	switch {
+	case errors.Is(err, ErrBlockedAddress) || ctx.Err() != nil:
+		return nil, err
+	case err != nil:
+		return disallowAll, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll, nil
+	case resp.StatusCode >= 400:
+		return nil, nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, robotsMaxBytes), token), nil
+}
+
+// parseRobots returns the rules of the group for token, or of the "*" group
+// if no group names token.
+func parseRobots(r io.Reader, token string) []robotsRule {
+	var (
+		specific, wildcard []robotsRule
+		foundSpecific      bool
+		agents             []string
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		switch name {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			for _, agent := range agents {
+				// An empty Disallow still selects the group.
+				if agent == token {
+					foundSpecific = true
+				}
+				if value == "" {
+					continue
+				}
+				rule := robotsRule{allow: name == "allow", length: len(value), pattern: robotsPattern(value)}
+				switch agent {
+				case token:
+					specific = append(specific, rule)
+				case "*":
+					wildcard = append(wildcard, rule)
+				}
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// robotsPattern compiles a robots.txt path pattern with "*" wildcards and an
+// optional "$" end anchor.
+func robotsPattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := "^" + strings.Join(parts, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// productToken returns the lower-cased name of userAgent without version and
+// comments, e.g. "selectorextractor" for "selectorextractor/1.0 (+https://...)".
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
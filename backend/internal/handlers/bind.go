@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"selectorextractor_backend/internal/ingest"
+	"selectorextractor_backend/pkg/extractor"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// uploadError is a problem with an uploaded file that is reported to the
+// client as is.
+type uploadError struct {
+	err error
+}
+
+func (e *uploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *uploadError) Unwrap() error {
+	return e.err
+}
+
+// maxBodyBytes bounds the size of a request body, uploads included. It leaves
+// room for a zip archive of the most HTML ingest reads plus the form values.
+const maxBodyBytes = ingest.MaxArchiveBytes + 10<<20
+
+// limitBody makes reads of the request body fail after maxBodyBytes.
+func limitBody(c echo.Context) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxBodyBytes)
+}
+
+func bindErrorMessage(err error) string {
+	var upload *uploadError
+	if errors.As(err, &upload) {
+		return upload.Error()
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Sprintf("Request body exceeds the limit of %d bytes", tooLarge.Limit)
+	}
+	return "Invalid request body"
+}
+
+// bindRequest binds a JSON body or a multipart form. Form values are decoded
+// as JSON where possible, e.g. "fields" or "fieldsToExtractSelectorsFor".
+// Uploaded .html, .htm, .mhtml and .zip files are transcoded to UTF-8: a
+// single "file" becomes "html" (and "url" if the file records where it was
+// saved from), every document of the "documents" files becomes an entry of
+// "documents". A "baseUrl" form value applies to all uploaded documents.
+// HAR and WARC archives contribute their HTML responses with the final URL
+// as "url" or base URL; an "entries" form value, a JSON array of indexes from
+// HandleArchiveEntriesRequest, selects some of them. Bodies larger than
+// maxBodyBytes are rejected.
+func bindRequest(c echo.Context, dst any) error {
+	limitBody(c)
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return c.Bind(dst)
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+
+	var entries []int
+	if raw := c.FormValue("entries"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+			return &uploadError{fmt.Errorf("entries must be a JSON array of indexes")}
+		}
+	}
+
+	values := make(map[string]any)
+	for key, list := range form.Value {
+		if len(list) == 0 || key == "entries" {
+			continue
+		}
+		var decoded any
+		if err := json.Unmarshal([]byte(list[0]), &decoded); err == nil {
+			values[key] = decoded
+		} else {
+			values[key] = list[0]
+		}
+	}
+
+	if headers := form.File["file"]; len(headers) > 0 {
+		documents, err := readUploads(headers, entries)
+		if err != nil {
+			return err
+		}
+		if len(documents) != 1 {
+			return &uploadError{fmt.Errorf("upload contains %d HTML documents, select one with entries or use the batch endpoints", len(documents))}
+		}
+		values["html"] = documents[0].HTML
+		if _, ok := values["url"]; !ok && documents[0].URL != "" {
+			values["url"] = documents[0].URL
+		}
+	}
+
+	if headers := form.File["documents"]; len(headers) > 0 {
+		documents, err := readUploads(headers, entries)
+		if err != nil {
+			return err
+		}
+		batch := make([]extractor.Document, 0, len(documents))
+		for _, document := range documents {
+			baseURL := c.FormValue("baseUrl")
+			if baseURL == "" {
+				baseURL = document.URL
+			}
+			batch = append(batch, extractor.Document{Name: document.Name, HTML: document.HTML, BaseURL: baseURL})
+		}
+		values["documents"] = batch
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// readUploads reads the documents of uploaded files. entries, if given,
+// selects responses of HAR and WARC archives.
+func readUploads(headers []*multipart.FileHeader, entries []int) ([]ingest.Document, error) {
+	var documents []ingest.Document
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		var read []ingest.Document
+		if len(entries) > 0 {
+			read, err = ingest.ReadEntries(header.Filename, data, entries)
+		} else {
+			read, err = ingest.ReadFile(header.Filename, data)
+		}
+		if err != nil {
+			return nil, &uploadError{err}
+		}
+		documents = append(documents, read...)
+	}
+	return documents, nil
+}
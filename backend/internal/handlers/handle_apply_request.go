@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/response"
+	"selectorextractor_backend/pkg/extractor"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ApplyResponse holds the values of an apply request in the order of its
+// fields.
+type ApplyResponse struct {
+	Values []extractor.Value `json:"values"`
+	Failed int               `json:"failed"`
+}
+
+// HandleApplyRequest runs saved selectors against the request's HTML and
+// returns typed values with per-field errors. It does not call the model.
+func (h *Handler) HandleApplyRequest(c echo.Context) error {
+	ctx := c.Request().Context()
+	logger := logging.FromContext(ctx)
+
+	var body extractor.ApplyRequest
+	if err := bindRequest(c, &body); err != nil {
+		logger.Warn("Failed to bind request body", "error", err)
+		return response.ValidationError(c, bindErrorMessage(err))
+	}
+
+	if body.HTML == "" && body.URL == "" {
+		return response.ValidationError(c, "HTML or URL is required")
+	}
+	if len(body.Fields) == 0 {
+		return response.ValidationError(c, "fields are required")
+	}
+
+	values, err := h.extractor.ApplyFields(ctx, body)
+	var fetchErr *extractor.FetchError
+	if errors.As(err, &fetchErr) {
+		logger.Warn("Failed to fetch page", "url", body.URL, "error", err)
+		return response.BadRequest(c, fetchErrorMessage(err))
+	}
+	if err != nil {
+		logger.Warn("Failed to apply selectors", "error", err)
+		return response.ValidationError(c, err.Error())
+	}
+
+	result := ApplyResponse{Values: values}
+	for _, value := range values {
+		if value.Error != "" {
+			result.Failed++
+		}
+	}
+	logger.Info("Applied selectors", "fields", len(values), "failed", result.Failed)
+
+	return response.Success(c, result)
+}
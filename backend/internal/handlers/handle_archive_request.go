@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"selectorextractor_backend/internal/ingest"
+	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ArchiveEntriesResponse lists the HTML responses of an uploaded archive.
+type ArchiveEntriesResponse struct {
+	Entries []ingest.Entry `json:"entries"`
+}
+
+// HandleArchiveEntriesRequest lists the HTML responses of a HAR or WARC
+// archive uploaded as "file", so that the caller can pick samples by their
+// index in the "entries" form value of the other endpoints.
+func (h *Handler) HandleArchiveEntriesRequest(c echo.Context) error {
+	logger := logging.FromContext(c.Request().Context())
+
+	limitBody(c)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return response.ValidationError(c, bindErrorMessage(err))
+	}
+	if err != nil {
+		return response.ValidationError(c, "an archive upload in \"file\" is required")
+	}
+	file, err := header.Open()
+	if err != nil {
+		logger.Warn("Failed to open upload", "error", err)
+		return response.ValidationError(c, "Invalid request body")
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		logger.Warn("Failed to read upload", "error", err)
+		return response.ValidationError(c, "Invalid request body")
+	}
+
+	entries, err := ingest.ListEntries(header.Filename, data)
+	if err != nil {
+		logger.Warn("Failed to read archive", "error", err)
+		return response.ValidationError(c, err.Error())
+	}
+	logger.Info("Listed archive entries", "file", header.Filename, "entries", len(entries))
+
+	return response.Success(c, ArchiveEntriesResponse{Entries: entries})
+}
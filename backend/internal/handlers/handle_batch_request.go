@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/export"
+	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/metrics"
+	"selectorextractor_backend/internal/quota"
+	"selectorextractor_backend/internal/response"
+	"selectorextractor_backend/internal/tracing"
+	"selectorextractor_backend/pkg/extractor"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxBatchDocuments limits the number of documents in one batch request.
+const maxBatchDocuments = 200
+
+// BatchApplyResponse holds the values of every document of a batch.
+type BatchApplyResponse struct {
+	Rows   []extractor.BatchRow `json:"rows"`
+	Failed int                  `json:"failed"`
+}
+
+// HandleBatchApplyRequest applies saved selectors to many documents. The
+// result is returned in the response envelope or, with ?format=csv, jsonl or
+// xlsx-csv, as a file with one row per document.
+func (h *Handler) HandleBatchApplyRequest(c echo.Context) error {
+	ctx := c.Request().Context()
+	logger := logging.FromContext(ctx)
+
+	format, err := exportFormat(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	var body extractor.BatchApplyRequest
+	if err := bindRequest(c, &body); err != nil {
+		logger.Warn("Failed to bind request body", "error", err)
+		return response.ValidationError(c, bindErrorMessage(err))
+	}
+	if err := validateDocuments(body.Documents); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+	if len(body.Fields) == 0 {
+		return response.ValidationError(c, "fields are required")
+	}
+
+	rows := h.extractor.ApplyBatch(ctx, body)
+	failed := countFailed(rows)
+	logger.Info("Applied selectors to batch", "documents", len(rows), "failed", failed)
+
+	if format != export.FormatJSON {
+		fields := make([]string, 0, len(body.Fields))
+		for _, field := range body.Fields {
+			fields = append(fields, field.Field)
+		}
+		return writeExport(c, format, fields, rows)
+	}
+	return response.Success(c, BatchApplyResponse{Rows: rows, Failed: failed})
+}
+
+// HandleBatchExtractRequest generates one selector set that is validated
+// against all documents of the batch. Export formats return the values the
+// selectors yield on each document.
+func (h *Handler) HandleBatchExtractRequest(c echo.Context) error {
+	ctx, span := tracing.Start(c.Request().Context(), "HandleBatchExtractRequest")
+	defer span.End()
+	logger := logging.FromContext(ctx)
+
+	format, err := exportFormat(c)
+	if err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	ext, err := h.extractorFor(c)
+	if err != nil {
+		logger.Warn("No API key provided")
+		return response.BadRequest(c, noAPIKeyMessage)
+	}
+
+	var body extractor.BatchExtractRequest
+	if err := bindRequest(c, &body); err != nil {
+		logger.Warn("Failed to bind request body", "error", err)
+		return response.ValidationError(c, bindErrorMessage(err))
+	}
+	if err := validateDocuments(body.Documents); err != nil {
+		return response.ValidationError(c, err.Error())
+	}
+
+	// The largest document stands in for every round when checking the
+	// request and reserving quota.
+	sample := ai.SendExtractionMessageRequest{
+		FieldsToExtractSelectorsFor: body.FieldsToExtractSelectorsFor,
+		Model:                       body.Model,
+		PromptVersion:               body.PromptVersion,
+	}
+	for _, document := range body.Documents {
+		if len(document.HTML) > len(sample.HTML) {
+			sample.HTML = document.HTML
+		}
+	}
+	if err := h.validateExtractionRequest(sample); err != nil {
+		logger.Warn("Request validation failed", "error", err)
+		return response.ValidationError(c, err.Error())
+	}
+
+	if client := auth.GetClient(c); client != nil && !client.AllowsModel(body.Model) {
+		logger.Warn("Model not allowed for client", "client", client.ID, "model", body.Model)
+		return response.Forbidden(c, "Model not allowed for this client")
+	}
+
+	span.SetAttributes(
+		attribute.String("model", body.Model),
+		attribute.Int("documents.count", len(body.Documents)),
+		attribute.Int("fields.count", len(body.FieldsToExtractSelectorsFor)),
+	)
+
+	// Every round is an extraction that may use all of its attempts.
+	reservation, err := h.reserveQuota(ctx, c, sample, extractor.BatchRounds*ai.MAX_TRIES)
+	if err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			logger.Warn("Quota exceeded", "client", auth.GetClient(c).ID, "limit", exceeded.Limit)
+			return response.QuotaExceededError(c, fmt.Sprintf("Quota exceeded: %s limit reached", exceeded.Limit))
+		}
+		logger.Error("Failed to check quota", "error", err)
+		return response.InternalError(c, "Failed to check quota")
+	}
+
+	logger.Info("Processing batch extraction request", "model", body.Model, "documents", len(body.Documents), "fields", len(body.FieldsToExtractSelectorsFor))
+
+	metrics.ExtractionsInFlight.Inc()
+	defer metrics.ExtractionsInFlight.Dec()
+
+	result, err := ext.ExtractBatch(ctx, body)
+	if reservation != nil {
+		reservation.Commit(quota.Usage{
+			Tokens: result.Usage.InputTokens + result.Usage.OutputTokens,
+			USD:    result.TotalPrice,
+		})
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.Error("Failed to process batch extraction request", "error", err)
+		return response.InternalError(c, "Failed to process batch extraction request")
+	}
+
+	logger.Info("Successfully processed batch extraction request",
+		"rounds", result.Rounds,
+		"failed_documents", countFailed(result.Rows),
+		"total_price", result.TotalPrice)
+
+	if format != export.FormatJSON {
+		fields := make([]string, 0, len(result.Fields))
+		for _, field := range result.Fields {
+			fields = append(fields, field.Field)
+		}
+		return writeExport(c, format, fields, result.Rows)
+	}
+	return response.Success(c, result)
+}
+
+func exportFormat(c echo.Context) (string, error) {
+	format := c.QueryParam("format")
+	if format == "" {
+		return export.FormatJSON, nil
+	}
+	if !export.IsFormat(format) {
+		return "", fmt.Errorf("unknown format %q, available: json, csv, jsonl, xlsx-csv", format)
+	}
+	return format, nil
+}
+
+func writeExport(c echo.Context, format string, fields []string, rows []extractor.BatchRow) error {
+	contentType, extension := export.ContentType(format)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "batch."+extension))
+	c.Response().WriteHeader(http.StatusOK)
+	return export.WriteRows(c.Response(), format, fields, rows)
+}
+
+// validateDocuments checks the documents of a batch and names unnamed ones
+// after their position.
+func validateDocuments(documents []extractor.Document) error {
+	if len(documents) == 0 {
+		return fmt.Errorf("documents are required")
+	}
+	if len(documents) > maxBatchDocuments {
+		return fmt.Errorf("at most %d documents are allowed per batch", maxBatchDocuments)
+	}
+	for i, document := range documents {
+		if document.HTML == "" {
+			return fmt.Errorf("document %d has no HTML", i+1)
+		}
+		if document.Name == "" {
+			documents[i].Name = fmt.Sprintf("document-%d", i+1)
+		}
+	}
+	return nil
+}
+
+func countFailed(rows []extractor.BatchRow) int {
+	failed := 0
+	for _, row := range rows {
+		if !row.Success {
+			failed++
+		}
+	}
+	return failed
+}
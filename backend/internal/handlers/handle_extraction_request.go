@@ -1,16 +1,42 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"selectorextractor_backend/internal/ai"
-	"selectorextractor_backend/internal/config"
-	"selectorextractor_backend/internal/helpers"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/fetch"
 	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/metrics"
+	"selectorextractor_backend/internal/quota"
 	"selectorextractor_backend/internal/response"
+	"selectorextractor_backend/internal/tracing"
+	"selectorextractor_backend/pkg/extractor"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Handler holds the dependencies shared by the API handlers.
+type Handler struct {
+	extractor *extractor.Extractor
+	keys      *ai.KeyPool
+	quotas    *quota.Tracker
+}
+
+// New creates a Handler. keys is nil when clients supply their own provider
+// key in the X-API-Key header.
+func New(ext *extractor.Extractor, keys *ai.KeyPool, quotas *quota.Tracker) *Handler {
+	return &Handler{
+		extractor: ext,
+		keys:      keys,
+		quotas:    quotas,
+	}
+}
+
 func HandleHealthCheck(c echo.Context) error {
 	return response.Success(c, map[string]string{
 		"status":  "healthy",
@@ -18,67 +44,213 @@ func HandleHealthCheck(c echo.Context) error {
 	})
 }
 
-func HandleExtractionRequest(c echo.Context, cfg config.AIConfig) error {
-	logging.InfoLogger.Println("Received extraction request")
-	apiKey := c.Request().Header.Get("X-API-Key")
-	if apiKey == "" {
-		logging.ErrorLogger.Println("No API key provided")
-		return response.InternalError(c, "No API key provided")
+func (h *Handler) HandleExtractionRequest(c echo.Context) error {
+	ctx, span := tracing.Start(c.Request().Context(), "HandleExtractionRequest")
+	defer span.End()
+	logger := logging.FromContext(ctx)
+	logger.Info("Received extraction request")
+
+	ext, err := h.extractorFor(c)
+	if err != nil {
+		logger.Warn("No API key provided")
+		return response.BadRequest(c, noAPIKeyMessage)
 	}
-	fmt.Println("API key: ", apiKey)
 
 	var body ai.SendExtractionMessageRequest
-	if err := c.Bind(&body); err != nil {
-		logging.ErrorLogger.Printf("Failed to bind request body: %v", err)
-		return response.ValidationError(c, "Invalid request body")
+	if err := bindRequest(c, &body); err != nil {
+		logger.Warn("Failed to bind request body", "error", err)
+		return response.ValidationError(c, bindErrorMessage(err))
 	}
 
 	// Validate request
-	if err := validateExtractionRequest(body); err != nil {
-		logging.ErrorLogger.Printf("Request validation failed: %v", err)
+	if err := h.validateExtractionRequest(body); err != nil {
+		logger.Warn("Request validation failed", "error", err)
 		return response.ValidationError(c, err.Error())
 	}
 
-	// Clean HTML
-	cleanedHTML := helpers.PrepareHtmlForExtraction(body.HTML)
-	body.HTML = cleanedHTML
+	if client := auth.GetClient(c); client != nil && !client.AllowsModel(body.Model) {
+		logger.Warn("Model not allowed for client", "client", client.ID, "model", body.Model)
+		return response.Forbidden(c, "Model not allowed for this client")
+	}
+
+	body, err = h.extractor.Load(ctx, body)
+	if err != nil {
+		logger.Warn("Failed to fetch page", "url", body.URL, "error", err)
+		return response.BadRequest(c, fetchErrorMessage(err))
+	}
 
-	logging.InfoLogger.Printf("Processing extraction request with model: %s", body.Model)
+	span.SetAttributes(
+		attribute.String("model", body.Model),
+		attribute.Int("html.size", len(body.HTML)),
+		attribute.Int("fields.count", len(body.FieldsToExtractSelectorsFor)),
+	)
+
+	// Check the client's quota against the estimate of every attempt the
+	// extraction may make before calling the model and debit the actual usage
+	// afterwards.
+	reservation, err := h.reserveQuota(ctx, c, body, ai.MAX_TRIES)
+	if err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			logger.Warn("Quota exceeded", "client", auth.GetClient(c).ID, "limit", exceeded.Limit)
+			return response.QuotaExceededError(c, fmt.Sprintf("Quota exceeded: %s limit reached", exceeded.Limit))
+		}
+		logger.Error("Failed to check quota", "error", err)
+		return response.InternalError(c, "Failed to check quota")
+	}
+
+	logger.Info("Processing extraction request", "model", body.Model, "html_length", len(body.HTML), "fields", len(body.FieldsToExtractSelectorsFor))
+
+	metrics.ExtractionsInFlight.Inc()
+	defer metrics.ExtractionsInFlight.Dec()
 
 	// Process request
-	result, err := ai.SendExtractionMessageOpenAI(body, apiKey, cfg)
+	result, err := ext.Extract(ctx, body)
+	if reservation != nil {
+		reservation.Commit(quota.Usage{
+			Tokens: result.Usage.InputTokens + result.Usage.OutputTokens,
+			USD:    result.TotalPrice,
+		})
+	}
 	if err != nil {
-		logging.ErrorLogger.Printf("Failed to process extraction request: %v", err)
+		tracing.RecordError(span, err)
+		logger.Error("Failed to process extraction request", "error", err)
 		return response.InternalError(c, "Failed to process extraction request")
 	}
 
-	logging.InfoLogger.Printf("Successfully processed extraction request. Total tokens used: %d",
-		result.Usage.InputTokens+result.Usage.OutputTokens)
+	logger.Info("Successfully processed extraction request",
+		"input_tokens", result.Usage.InputTokens,
+		"output_tokens", result.Usage.OutputTokens,
+		"total_price", result.TotalPrice)
 
 	return response.Success(c, result)
 }
 
-func validateExtractionRequest(req ai.SendExtractionMessageRequest) error {
-	if req.HTML == "" {
-		return fmt.Errorf("HTML is required")
+// HandleEstimateRequest returns the estimated tokens and price of an
+// extraction request without calling the model.
+func (h *Handler) HandleEstimateRequest(c echo.Context) error {
+	logger := logging.FromContext(c.Request().Context())
+
+	var body ai.SendExtractionMessageRequest
+	if err := bindRequest(c, &body); err != nil {
+		logger.Warn("Failed to bind request body", "error", err)
+		return response.ValidationError(c, bindErrorMessage(err))
+	}
+
+	if err := h.validateExtractionRequest(body); err != nil {
+		logger.Warn("Request validation failed", "error", err)
+		return response.ValidationError(c, err.Error())
+	}
+
+	if client := auth.GetClient(c); client != nil && !client.AllowsModel(body.Model) {
+		logger.Warn("Model not allowed for client", "client", client.ID, "model", body.Model)
+		return response.Forbidden(c, "Model not allowed for this client")
+	}
+
+	estimate, err := h.extractor.Estimate(c.Request().Context(), body)
+	var fetchErr *extractor.FetchError
+	if errors.As(err, &fetchErr) {
+		logger.Warn("Failed to fetch page", "url", body.URL, "error", err)
+		return response.BadRequest(c, fetchErrorMessage(err))
+	}
+	if err != nil {
+		logger.Error("Failed to estimate extraction request", "error", err)
+		return response.InternalError(c, "Failed to estimate extraction request")
+	}
+
+	return response.Success(c, estimate)
+}
+
+// fetchErrors are the fetch failures whose reason is shown to the client.
+// Other failures, such as connection errors, name the resolved address and are
+// only logged.
+var fetchErrors = []error{
+	fetch.ErrBlockedAddress,
+	fetch.ErrUnsupportedScheme,
+	fetch.ErrTooManyRedirects,
+	fetch.ErrTooLarge,
+	fetch.ErrDisallowedByRobots,
+	fetch.ErrUnsupportedContent,
+	fetch.ErrStatus,
+}
+
+// fetchErrorMessage returns the client-facing message for a failed fetch
+// without the URL, address or underlying error.
+func fetchErrorMessage(err error) string {
+	for _, known := range fetchErrors {
+		if errors.Is(err, known) {
+			return "Failed to fetch page: " + known.Error()
+		}
+	}
+	return "Failed to fetch page"
+}
+
+// noAPIKeyMessage is the error for requests without an X-API-Key header to
+// servers that manage no provider keys.
+const noAPIKeyMessage = "No API key provided: send your OpenRouter API key in the X-API-Key header"
+
+// extractorFor returns the extractor for the request: with the server's key
+// pool, or with the provider key from the X-API-Key header if the server
+// manages no keys.
+func (h *Handler) extractorFor(c echo.Context) (*extractor.Extractor, error) {
+	if h.keys != nil {
+		return h.extractor.UsingKeys(h.keys), nil
+	}
+	apiKey := c.Request().Header.Get("X-API-Key")
+	if apiKey == "" && h.extractor.RequiresAPIKey() {
+		return nil, errors.New("no API key provided")
+	}
+	return h.extractor.UsingKeys(ai.StaticKey(apiKey)), nil
+}
+
+// reserveQuota reserves the estimated usage of calls model calls for the
+// request against the authenticated client's quota. It returns a nil
+// reservation for unauthenticated requests.
+func (h *Handler) reserveQuota(ctx context.Context, c echo.Context, body ai.SendExtractionMessageRequest, calls int) (*quota.Reservation, error) {
+	client := auth.GetClient(c)
+	if client == nil {
+		return nil, nil
+	}
+
+	estimate, err := h.extractor.Estimate(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.quotas.Reserve(client.ID, client.Quota, quota.Usage{
+		Tokens: calls * (estimate.Usage.InputTokens + estimate.Usage.OutputTokens),
+		USD:    float64(calls) * estimate.TotalPrice,
+	})
+}
+
+func (h *Handler) validateExtractionRequest(req ai.SendExtractionMessageRequest) error {
+	if req.HTML == "" && req.URL == "" {
+		return fmt.Errorf("HTML or URL is required")
 	}
 
 	if len(req.FieldsToExtractSelectorsFor) == 0 {
 		return fmt.Errorf("fields to extract selectors for is required")
 	}
 
+	if err := ai.CheckFields(req.FieldsToExtractSelectorsFor); err != nil {
+		return err
+	}
+
+	if req.BaseURL != "" {
+		if base, err := url.Parse(req.BaseURL); err != nil || !base.IsAbs() {
+			return fmt.Errorf("invalid base URL %q", req.BaseURL)
+		}
+	}
+
 	if req.Model == "" {
 		return fmt.Errorf("model is required")
 	}
 
-	validModel := false
-	for _, model := range ai.MODEL_LIST {
-		if model == req.Model {
-			validModel = true
-			break
-		}
+	if req.PromptVersion != "" && !ai.IsPromptVersion(req.PromptVersion) {
+		return fmt.Errorf("unknown prompt version %q, available: %s", req.PromptVersion, strings.Join(ai.PromptVersions(), ", "))
 	}
-	if !validModel {
+
+	if !h.extractor.SupportsModel(req.Model) {
 		return fmt.Errorf("invalid model specified")
 	}
 
@@ -0,0 +1,406 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/handlers"
+	"selectorextractor_backend/internal/middleware"
+	"selectorextractor_backend/internal/quota"
+	"selectorextractor_backend/internal/response"
+	"selectorextractor_backend/pkg/extractor"
+
+	"github.com/labstack/echo/v4"
+	"github.com/revrost/go-openrouter"
+)
+
+const (
+	token     = "test-token"
+	testModel = "x-ai/grok-3-mini"
+	titleHTML = "<html><body><h1>Title</h1></body></html>"
+)
+
+var titleUsage = openrouter.Usage{PromptTokens: 100, CompletionTokens: 10}
+
+// envelope is response.Response with the data left undecoded.
+type envelope struct {
+	Success bool                    `json:"success"`
+	Data    json.RawMessage         `json:"data"`
+	Error   *response.ErrorResponse `json:"error"`
+}
+
+// newServer returns the API routes in server auth mode for a single client
+// with the token above, answering extractions with steps.
+func newServer(t *testing.T, client auth.Client, steps ...ai.ScriptStep) *echo.Echo {
+	t.Helper()
+	if len(steps) == 0 {
+		step := ai.Answer(ai.ExtractedSelector{Field: "title", Selector: "h1", ExtractMethod: "textContent"})
+		step.Usage = titleUsage
+		steps = []ai.ScriptStep{step}
+	}
+
+	entries, err := json.Marshal([]map[string]any{{
+		"id":            client.ID,
+		"token":         token,
+		"allowedModels": client.AllowedModels,
+		"quota":         client.Quota,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(tokensFile, entries, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.NewAuthenticator(config.AuthConfig{TokensFile: tokensFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext, err := extractor.New(extractor.WithProvider(ai.NewScriptedProvider(steps...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.New(ext, ai.NewKeyPool([]string{"provider-key"}, time.Minute), quota.NewTracker())
+	m := middleware.New(config.RateLimitConfig{})
+
+	e := echo.New()
+	protected := m.Authenticate(authenticator)
+	v1 := e.Group("/api/v1")
+	v1.POST("/extract", h.HandleExtractionRequest, protected)
+	v1.POST("/estimate", h.HandleEstimateRequest, protected)
+	v1.POST("/apply", h.HandleApplyRequest, protected)
+	v1.POST("/batch/extract", h.HandleBatchExtractRequest, protected)
+	v1.POST("/batch/apply", h.HandleBatchApplyRequest, protected)
+	v1.POST("/archive/entries", h.HandleArchiveEntriesRequest, protected)
+	return e
+}
+
+// post sends body to path, as JSON unless contentType is given, and decodes
+// the response envelope.
+func post(t *testing.T, e *echo.Echo, path, bearer, contentType string, body []byte) (int, envelope) {
+	t.Helper()
+	if contentType == "" {
+		contentType = echo.MIMEApplicationJSON
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	if bearer != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var result envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%s: invalid response %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, result
+}
+
+func postJSON(t *testing.T, e *echo.Echo, path string, body any) (int, envelope) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post(t, e, path, token, "", data)
+}
+
+func extractionBody() map[string]any {
+	return map[string]any{
+		"html":                        titleHTML,
+		"fieldsToExtractSelectorsFor": []ai.FieldToExtractSelectorsFor{{Name: "title", Type: "text"}},
+		"model":                       testModel,
+	}
+}
+
+func batchBody() map[string]any {
+	return map[string]any{
+		"documents": []extractor.Document{
+			{Name: "a.html", HTML: titleHTML},
+			{Name: "b.html", HTML: "<html><body><h1>Other</h1></body></html>"},
+		},
+		"fieldsToExtractSelectorsFor": []ai.FieldToExtractSelectorsFor{{Name: "title", Type: "text"}},
+		"model":                       testModel,
+	}
+}
+
+func wantError(t *testing.T, path string, status int, result envelope, wantStatus int, wantCode string) {
+	t.Helper()
+	if status != wantStatus || result.Success || result.Error == nil || result.Error.Code != wantCode {
+		t.Errorf("%s = %d %+v, want %d %s", path, status, result.Error, wantStatus, wantCode)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	for _, path := range []string{"/api/v1/extract", "/api/v1/estimate", "/api/v1/apply", "/api/v1/batch/extract", "/api/v1/batch/apply", "/api/v1/archive/entries"} {
+		for _, bearer := range []string{"", "wrong-token"} {
+			status, result := post(t, e, path, bearer, "", []byte("{}"))
+			wantError(t, path, status, result, http.StatusUnauthorized, "UNAUTHORIZED")
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	status, result := postJSON(t, e, "/api/v1/extract", extractionBody())
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("extract = %d %+v", status, result.Error)
+	}
+	var data extractor.Result
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Fields) != 1 || data.Fields[0].Selector != "h1" || !data.Fields[0].Valid {
+		t.Errorf("fields = %+v, want a valid h1 selector", data.Fields)
+	}
+	if data.Usage.InputTokens != titleUsage.PromptTokens {
+		t.Errorf("input tokens = %d, want %d", data.Usage.InputTokens, titleUsage.PromptTokens)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(titleHTML))
+	}))
+	defer page.Close()
+
+	noFields := extractionBody()
+	delete(noFields, "fieldsToExtractSelectorsFor")
+	badModel := extractionBody()
+	badModel["model"] = "unknown/model"
+	private := extractionBody()
+	delete(private, "html")
+	private["url"] = strings.Replace(page.URL, "127.0.0.1", "localhost", 1)
+
+	for _, path := range []string{"/api/v1/extract", "/api/v1/estimate"} {
+		e := newServer(t, auth.Client{ID: "acme"})
+		status, result := post(t, e, path, token, "", []byte("{"))
+		wantError(t, path+" malformed", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+		status, result = postJSON(t, e, path, noFields)
+		wantError(t, path+" without fields", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+		status, result = postJSON(t, e, path, badModel)
+		wantError(t, path+" with unknown model", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+
+		status, result = postJSON(t, e, path, private)
+		wantError(t, path+" of a private URL", status, result, http.StatusBadRequest, "BAD_REQUEST")
+		if result.Error != nil && strings.Contains(result.Error.Message, "127.0.0.1") {
+			t.Errorf("%s: message %q names the resolved address", path, result.Error.Message)
+		}
+	}
+
+	e := newServer(t, auth.Client{ID: "acme"}, ai.ScriptStep{Error: "upstream unavailable"})
+	status, result := postJSON(t, e, "/api/v1/extract", extractionBody())
+	wantError(t, "extract with failing provider", status, result, http.StatusInternalServerError, "INTERNAL_ERROR")
+}
+
+func TestExtractModelNotAllowed(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme", AllowedModels: []string{"google/gemini-2.5-pro"}})
+	for _, path := range []string{"/api/v1/extract", "/api/v1/estimate", "/api/v1/batch/extract"} {
+		body := extractionBody()
+		if strings.Contains(path, "batch") {
+			body = batchBody()
+		}
+		status, result := postJSON(t, e, path, body)
+		wantError(t, path, status, result, http.StatusForbidden, "FORBIDDEN")
+	}
+}
+
+func TestExtractWithoutAPIKey(t *testing.T) {
+	// Without a key pool, clients send their own provider key.
+	ext, err := extractor.New(extractor.WithProvider(ai.OpenRouterProvider{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.New(ext, nil, quota.NewTracker())
+	e := echo.New()
+	e.POST("/api/v1/extract", h.HandleExtractionRequest)
+	e.POST("/api/v1/batch/extract", h.HandleBatchExtractRequest)
+
+	for path, body := range map[string]map[string]any{
+		"/api/v1/extract":       extractionBody(),
+		"/api/v1/batch/extract": batchBody(),
+	} {
+		status, result := postJSON(t, e, path, body)
+		wantError(t, path, status, result, http.StatusBadRequest, "BAD_REQUEST")
+		if result.Error != nil && !strings.Contains(result.Error.Message, "X-API-Key") {
+			t.Errorf("%s: message %q does not name the X-API-Key header", path, result.Error.Message)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	status, result := postJSON(t, e, "/api/v1/estimate", extractionBody())
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("estimate = %d %+v", status, result.Error)
+	}
+	var data extractor.Estimate
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Usage.InputTokens == 0 || data.TotalPrice == 0 || data.Model != testModel {
+		t.Errorf("estimate = %+v, want tokens and price for %s", data, testModel)
+	}
+}
+
+// estimateTokens returns the estimated tokens of one attempt of body.
+func estimateTokens(t *testing.T, body map[string]any) int {
+	t.Helper()
+	status, result := postJSON(t, newServer(t, auth.Client{ID: "estimate"}), "/api/v1/estimate", body)
+	if status != http.StatusOK {
+		t.Fatalf("estimate = %d %+v", status, result.Error)
+	}
+	var data extractor.Estimate
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Usage.InputTokens + data.Usage.OutputTokens
+}
+
+func TestExtractQuota(t *testing.T) {
+	tokens := estimateTokens(t, extractionBody())
+
+	// The reservation covers every attempt, not just the first.
+	e := newServer(t, auth.Client{ID: "acme", Quota: quota.Limits{TokensPerDay: 2 * tokens}})
+	status, result := postJSON(t, e, "/api/v1/extract", extractionBody())
+	wantError(t, "extract over quota", status, result, http.StatusTooManyRequests, "QUOTA_EXCEEDED")
+
+	e = newServer(t, auth.Client{ID: "acme", Quota: quota.Limits{TokensPerDay: ai.MAX_TRIES * tokens}})
+	if status, result := postJSON(t, e, "/api/v1/extract", extractionBody()); status != http.StatusOK {
+		t.Errorf("extract within quota = %d %+v", status, result.Error)
+	}
+
+	e = newServer(t, auth.Client{ID: "acme", Quota: quota.Limits{RequestsPerDay: 1}})
+	postJSON(t, e, "/api/v1/extract", extractionBody())
+	status, result = postJSON(t, e, "/api/v1/extract", extractionBody())
+	wantError(t, "extract over request quota", status, result, http.StatusTooManyRequests, "QUOTA_EXCEEDED")
+}
+
+func TestApply(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	status, result := postJSON(t, e, "/api/v1/apply", map[string]any{
+		"html": titleHTML,
+		"fields": []map[string]any{
+			{"field": "title", "selector": "h1", "type": "text"},
+			{"field": "missing", "selector": ".missing", "type": "text"},
+		},
+	})
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("apply = %d %+v", status, result.Error)
+	}
+	var data handlers.ApplyResponse
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Values) != 2 || data.Values[0].Value != "Title" || data.Values[1].Error == "" || data.Failed != 1 {
+		t.Errorf("apply = %+v, want the title and one failed field", data)
+	}
+
+	status, result = postJSON(t, e, "/api/v1/apply", map[string]any{"html": titleHTML})
+	wantError(t, "apply without fields", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+
+	status, result = postJSON(t, e, "/api/v1/apply", map[string]any{
+		"url":    "http://127.0.0.1:1/",
+		"fields": []map[string]any{{"field": "title", "selector": "h1"}},
+	})
+	wantError(t, "apply of a private URL", status, result, http.StatusBadRequest, "BAD_REQUEST")
+}
+
+func TestBatchExtract(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	status, result := postJSON(t, e, "/api/v1/batch/extract", batchBody())
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("batch extract = %d %+v", status, result.Error)
+	}
+	var data extractor.BatchExtractResult
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Rounds != 1 || len(data.Coverage) != 1 || data.Coverage[0].Passed != 2 || len(data.Rows) != 2 {
+		t.Errorf("batch extract = %+v, want one round covering both documents", data)
+	}
+
+	status, result = postJSON(t, e, "/api/v1/batch/extract", map[string]any{"model": testModel})
+	wantError(t, "batch extract without documents", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+
+	e = newServer(t, auth.Client{ID: "acme"}, ai.ScriptStep{Error: "upstream unavailable"})
+	status, result = postJSON(t, e, "/api/v1/batch/extract", batchBody())
+	wantError(t, "batch extract with failing provider", status, result, http.StatusInternalServerError, "INTERNAL_ERROR")
+}
+
+func TestBatchExtractQuota(t *testing.T) {
+	tokens := estimateTokens(t, extractionBody())
+	e := newServer(t, auth.Client{ID: "acme", Quota: quota.Limits{TokensPerDay: ai.MAX_TRIES * tokens}})
+	status, result := postJSON(t, e, "/api/v1/batch/extract", batchBody())
+	wantError(t, "batch extract over quota", status, result, http.StatusTooManyRequests, "QUOTA_EXCEEDED")
+}
+
+func TestBatchApply(t *testing.T) {
+	e := newServer(t, auth.Client{ID: "acme"})
+	body := batchBody()
+	delete(body, "fieldsToExtractSelectorsFor")
+	body["fields"] = []map[string]any{{"field": "title", "selector": "h1", "type": "text"}}
+	status, result := postJSON(t, e, "/api/v1/batch/apply", body)
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("batch apply = %d %+v", status, result.Error)
+	}
+	var data handlers.BatchApplyResponse
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Rows) != 2 || data.Failed != 0 || data.Rows[1].Values[0].Value != "Other" {
+		t.Errorf("batch apply = %+v, want both titles", data)
+	}
+
+	delete(body, "fields")
+	status, result = postJSON(t, e, "/api/v1/batch/apply", body)
+	wantError(t, "batch apply without fields", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+}
+
+func TestArchiveEntries(t *testing.T) {
+	har, err := json.Marshal(map[string]any{"log": map[string]any{"entries": []map[string]any{{
+		"request":  map[string]any{"url": "https://shop.example/p/1"},
+		"response": map[string]any{"status": 200, "content": map[string]any{"mimeType": "text/html", "text": titleHTML}},
+	}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "session.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(har)
+	form.Close()
+
+	e := newServer(t, auth.Client{ID: "acme"})
+	status, result := post(t, e, "/api/v1/archive/entries", token, form.FormDataContentType(), body.Bytes())
+	if status != http.StatusOK || !result.Success {
+		t.Fatalf("archive entries = %d %+v", status, result.Error)
+	}
+	var data handlers.ArchiveEntriesResponse
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Entries) != 1 || data.Entries[0].URL != "https://shop.example/p/1" {
+		t.Errorf("entries = %+v, want the HTML response", data.Entries)
+	}
+
+	status, result = post(t, e, "/api/v1/archive/entries", token, "", []byte("{}"))
+	wantError(t, "archive entries without a file", status, result, http.StatusUnprocessableEntity, "VALIDATION_ERROR")
+}
@@ -2,12 +2,54 @@ package helpers
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 )
 
+// Cleaner profiles select how aggressively HTML is reduced before it is sent
+// to the model.
+const (
+	CleanerProfileDefault = "default"
+	CleanerProfileMinimal = "minimal"
+	CleanerProfileNone    = "none"
+)
+
+var cleanerProfiles = map[string]func(string) string{
+	CleanerProfileDefault: PrepareHtmlForExtraction,
+	CleanerProfileMinimal: PrepareHtmlMinimal,
+	CleanerProfileNone:    func(html string) string { return html },
+}
+
+// CleanerForProfile returns the cleaning function of the named profile.
+func CleanerForProfile(profile string) (func(string) string, bool) {
+	cleaner, ok := cleanerProfiles[profile]
+	return cleaner, ok
+}
+
+// CleanerProfiles returns the names of the available cleaner profiles.
+func CleanerProfiles() []string {
+	profiles := make([]string, 0, len(cleanerProfiles))
+	for profile := range cleanerProfiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// PrepareHtmlMinimal only removes content that never carries extractable
+// values (scripts, styles, comments and SVG) and keeps all attributes.
+func PrepareHtmlMinimal(html string) string {
+	return removePatterns(html, []string{
+		`<svg[^>]*>.*?</svg>`,
+		`<script[^>]*>.*?</script>`,
+		`<style[^>]*>.*?</style>`,
+		`<!--.*?-->`,
+	})
+}
+
 func PrepareHtmlForExtraction(html string) string {
 	// Define patterns for elements to remove
-	patterns := []string{
+	return removePatterns(html, []string{
 		`<svg[^>]*>.*?</svg>`,           // SVG tags and content
 		`<script[^>]*>.*?</script>`,     // Script tags and content
 		`<style[^>]*>.*?</style>`,       // Style tags and content
@@ -18,13 +60,14 @@ func PrepareHtmlForExtraction(html string) string {
 		`<template[^>]*>.*?</template>`, // template elements
 		`<meta[^>]*>`,                   // meta tags
 		`<link[^>]*>`,                   // link tags
-		`<base[^>]*>`,                   // base tags
 		`on\w+="[^"]*"`,                 // inline event handlers
 		`data-[^=]*="[^"]*"`,            // data attributes
 		`aria-[^=]*="[^"]*"`,            // aria attributes
 		`role="[^"]*"`,                  // role attributes
-	}
+	})
+}
 
+func removePatterns(html string, patterns []string) string {
 	// Compile all patterns
 	var regexps []*regexp.Regexp
 	for _, pattern := range patterns {
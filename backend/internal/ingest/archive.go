@@ -0,0 +1,324 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotArchive = errors.New("entries can only be selected from .har and .warc files")
+	ErrNoEntry    = errors.New("archive has no HTML response with this index")
+)
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Entry is an HTML response recorded in a HAR or WARC archive. Index is its
+// position among the archive's HTML responses and is used to select it.
+type Entry struct {
+	Index       int    `json:"index"`
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Charset     string `json:"charset"`
+	Size        int    `json:"size"`
+	Title       string `json:"title,omitempty"`
+}
+
+// response is a successful HTML response read from an archive. HAR archives
+// usually store bodies as text already decoded by the browser, which is
+// marked by decoded.
+type response struct {
+	url         string
+	status      int
+	contentType string
+	body        []byte
+	decoded     bool
+}
+
+func (r response) document(name string) (Document, error) {
+	if !r.decoded {
+		document, err := readHTML(name, r.body, r.contentType)
+		document.URL = r.url
+		return document, err
+	}
+	charset := "utf-8"
+	if _, params, err := mime.ParseMediaType(r.contentType); err == nil && params["charset"] != "" {
+		charset = strings.ToLower(params["charset"])
+	}
+	return Document{
+		Name:    name,
+		HTML:    strings.TrimPrefix(string(r.body), "\ufeff"),
+		Charset: charset,
+		URL:     r.url,
+	}, nil
+}
+
+func isArchive(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".har") || strings.HasSuffix(lower, ".warc") || strings.HasSuffix(lower, ".warc.gz")
+}
+
+func readResponses(name string, data []byte) ([]response, error) {
+	var (
+		responses []response
+		err       error
+	)
+	if strings.HasSuffix(strings.ToLower(name), ".har") {
+		responses, err = readHAR(data)
+	} else {
+		responses, err = readWARC(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoHTML)
+	}
+	return responses, nil
+}
+
+// ListEntries returns the HTML responses of a HAR or WARC archive. Redirects,
+// error responses and other content types are left out, so the URL of an
+// entry is the final URL of its page.
+func ListEntries(name string, data []byte) ([]Entry, error) {
+	if !isArchive(name) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotArchive)
+	}
+	responses, err := readResponses(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(responses))
+	for i, r := range responses {
+		document, err := r.document(name)
+		if err != nil {
+			return nil, err
+		}
+		entry := Entry{
+			Index:       i,
+			URL:         r.url,
+			Status:      r.status,
+			ContentType: r.contentType,
+			Charset:     document.Charset,
+			Size:        len(document.HTML),
+		}
+		if match := titlePattern.FindStringSubmatch(document.HTML); match != nil {
+			entry.Title = strings.Join(strings.Fields(html.UnescapeString(match[1])), " ")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ReadEntries reads the selected HTML responses of a HAR or WARC archive, or
+// all of them if indexes is empty. Documents are named after the archive and
+// the entry's index, e.g. "crawl.har#3".
+func ReadEntries(name string, data []byte, indexes []int) ([]Document, error) {
+	if !isArchive(name) {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotArchive)
+	}
+	responses, err := readResponses(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(indexes) == 0 {
+		if len(responses) > MaxArchiveFiles {
+			return nil, fmt.Errorf("%s: %w: more than %d documents, select entries", name, ErrArchiveTooLarge, MaxArchiveFiles)
+		}
+		indexes = make([]int, len(responses))
+		for i := range responses {
+			indexes[i] = i
+		}
+	}
+
+	documents := make([]Document, 0, len(indexes))
+	for _, index := range indexes {
+		if index < 0 || index >= len(responses) {
+			return nil, fmt.Errorf("%s: %w: %d", name, ErrNoEntry, index)
+		}
+		document, err := responses[index].document(name + "#" + strconv.Itoa(index))
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// readHAR returns the HTML responses of a HTTP Archive. Bodies encoded as
+// base64 are kept as bytes and decoded like fetched pages; plain text bodies
+// were already decoded by the browser that recorded them.
+func readHAR(data []byte) ([]response, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+
+	var responses []response
+	for _, entry := range har.Log.Entries {
+		content := entry.Response.Content
+		if !isSuccess(entry.Response.Status) || !isHTML(content.MimeType) || content.Text == "" {
+			continue
+		}
+		r := response{
+			url:         entry.Request.URL,
+			status:      entry.Response.Status,
+			contentType: content.MimeType,
+			body:        []byte(content.Text),
+			decoded:     true,
+		}
+		if content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, fmt.Errorf("entry %s: %w", entry.Request.URL, err)
+			}
+			r.body, r.decoded = body, false
+		}
+		responses = append(responses, r)
+	}
+	return responses, nil
+}
+
+// readWARC returns the HTML responses of a Web ARChive, optionally gzipped
+// per record as crawlers write .warc.gz files. Response records hold the raw
+// HTTP response, which is de-chunked and decompressed here.
+func readWARC(data []byte) ([]response, error) {
+	var source io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(source)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		source = gz
+	}
+	reader := bufio.NewReader(io.LimitReader(source, MaxArchiveBytes+1))
+
+	var (
+		responses []response
+		read      int64
+	)
+	for {
+		version, err := reader.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(version) == "" {
+			return responses, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid WARC file: %w", err)
+		}
+		if strings.TrimSpace(version) == "" {
+			// Records are separated by blank lines.
+			continue
+		}
+		if !strings.HasPrefix(version, "WARC/") {
+			return nil, fmt.Errorf("invalid WARC file: unexpected line %q", strings.TrimSpace(version))
+		}
+
+		header, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("invalid WARC record header: %w", err)
+		}
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid WARC record length %q", header.Get("Content-Length"))
+		}
+		if read += length; read > MaxArchiveBytes {
+			return nil, fmt.Errorf("%w of %d bytes", ErrArchiveTooLarge, MaxArchiveBytes)
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(reader, block); err != nil {
+			return nil, fmt.Errorf("invalid WARC record: %w", err)
+		}
+
+		target := strings.Trim(header.Get("WARC-Target-URI"), "<>")
+		switch header.Get("WARC-Type") {
+		case "response":
+			if r, ok := readHTTPResponse(target, block); ok {
+				responses = append(responses, r)
+			}
+		case "resource":
+			if isHTML(header.Get("Content-Type")) {
+				responses = append(responses, response{url: target, status: http.StatusOK, contentType: header.Get("Content-Type"), body: block})
+			}
+		}
+	}
+}
+
+// readHTTPResponse parses the HTTP response stored in a WARC response record
+// and reports whether it is a successful HTML response that could be read.
+func readHTTPResponse(target string, block []byte) (response, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil {
+		return response{}, false
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isSuccess(resp.StatusCode) || !isHTML(contentType) {
+		return response{}, false
+	}
+
+	body := io.Reader(resp.Body)
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return response{}, false
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return response{}, false
+	}
+	data, err := io.ReadAll(io.LimitReader(body, MaxArchiveBytes))
+	if err != nil {
+		return response{}, false
+	}
+	return response{url: target, status: resp.StatusCode, contentType: contentType, body: data}, true
+}
+
+func isSuccess(status int) bool {
+	return status >= 200 && status < 300
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
@@ -0,0 +1,111 @@
+// Package ingest turns raw documents from uploads, fetches and archives into
+// UTF-8 HTML.
+package ingest
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]*charset\s*=\s*["']?\s*([a-z0-9_.:-]+)`)
+
+// detectCandidates are the multi-byte encodings tried when a document declares
+// no encoding and is not valid UTF-8.
+var detectCandidates = []string{"shift_jis", "euc-jp", "gbk", "big5", "euc-kr"}
+
+// Decode transcodes an HTML document to UTF-8 and returns the name of its
+// original encoding. The encoding is taken from a byte order mark, the
+// charset parameter of contentType or a <meta charset> declaration, in that
+// order. Undeclared documents are kept as UTF-8 if they are valid UTF-8 and
+// otherwise detected from their bytes, falling back to windows-1252 like
+// browsers do.
+func Decode(data []byte, contentType string) (string, string, error) {
+	enc, name := determineEncoding(data, contentType)
+	if enc == nil {
+		return strings.TrimPrefix(string(data), "\ufeff"), "utf-8", nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", name, err
+	}
+	return strings.TrimPrefix(string(decoded), "\ufeff"), name, nil
+}
+
+// determineEncoding returns the document's encoding, or nil for UTF-8.
+func determineEncoding(data []byte, contentType string) (encoding.Encoding, string) {
+	if enc, name, certain := charset.DetermineEncoding(data, contentType); certain {
+		return utf8OrNil(enc, name)
+	}
+
+	head := data[:min(len(data), 1024)]
+	if match := metaCharsetPattern.FindSubmatch(head); match != nil {
+		if enc, name := charset.Lookup(string(match[1])); enc != nil {
+			return utf8OrNil(enc, name)
+		}
+	}
+
+	if utf8.Valid(data) {
+		return nil, "utf-8"
+	}
+	return detect(data)
+}
+
+func utf8OrNil(enc encoding.Encoding, name string) (encoding.Encoding, string) {
+	if name == "utf-8" {
+		return nil, name
+	}
+	return enc, name
+}
+
+// detect picks the multi-byte candidate that decodes data without errors
+// into the largest share of CJK characters, or windows-1252 if none does.
+func detect(data []byte) (encoding.Encoding, string) {
+	var (
+		best      encoding.Encoding
+		bestName  = "windows-1252"
+		bestScore = 0.5
+	)
+	for _, candidate := range detectCandidates {
+		enc, name := charset.Lookup(candidate)
+		decoded, err := enc.NewDecoder().Bytes(data)
+		if err != nil || strings.ContainsRune(string(decoded), utf8.RuneError) {
+			continue
+		}
+		if score := cjkShare(string(decoded)); score > bestScore {
+			best, bestName, bestScore = enc, name, score
+		}
+	}
+	if best == nil {
+		best, _ = charset.Lookup("windows-1252")
+	}
+	return best, bestName
+}
+
+// cjkShare returns the share of non-ASCII letters in s that are Han, Kana or
+// Hangul. Japanese text additionally scores for Kana, which separates it from
+// Chinese text that happens to decode as Shift_JIS.
+func cjkShare(s string) float64 {
+	total, cjk := 0, 0.0
+	for _, r := range s {
+		if r < utf8.RuneSelf || !unicode.IsLetter(r) {
+			continue
+		}
+		total++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			cjk += 1.1
+		case unicode.In(r, unicode.Han, unicode.Hangul):
+			cjk++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return cjk / float64(total)
+}
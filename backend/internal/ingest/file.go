@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+const (
+	// MaxArchiveFiles and MaxArchiveBytes bound the HTML read from one zip
+	// archive, so that a small upload cannot expand into gigabytes.
+	MaxArchiveFiles = 500
+	MaxArchiveBytes = 50 << 20
+)
+
+var (
+	ErrUnsupportedFile = errors.New("unsupported file type, expected .html, .htm, .mhtml, .zip, .har or .warc")
+	ErrNoHTML          = errors.New("no HTML document found")
+	ErrArchiveTooLarge = errors.New("archive exceeds the size limit")
+)
+
+// Document is an HTML document read from an upload, transcoded to UTF-8.
+type Document struct {
+	Name string
+	HTML string
+	// Charset is the document's original encoding.
+	Charset string
+	// URL is the address the document was saved from, if the file records it.
+	URL string
+}
+
+// ReadFile reads the HTML documents of an uploaded file, chosen by its
+// extension: one for .html, .htm, .mhtml and .mht files, all HTML entries for
+// .zip archives and all HTML responses for .har, .warc and .warc.gz files.
+func ReadFile(name string, data []byte) ([]Document, error) {
+	if isArchive(name) {
+		return ReadEntries(name, data, nil)
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		document, err := readHTML(name, data, "")
+		if err != nil {
+			return nil, err
+		}
+		return []Document{document}, nil
+	case ".mhtml", ".mht":
+		document, err := readMHTML(name, data)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{document}, nil
+	case ".zip":
+		return readZip(name, data)
+	default:
+		return nil, fmt.Errorf("%s: %w", name, ErrUnsupportedFile)
+	}
+}
+
+func readHTML(name string, data []byte, contentType string) (Document, error) {
+	html, charset, err := Decode(data, contentType)
+	if err != nil {
+		return Document{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return Document{Name: name, HTML: html, Charset: charset}, nil
+}
+
+// readMHTML returns the first text/html part of a web archive saved by a
+// browser, with the address it was saved from.
+func readMHTML(name string, data []byte) (Document, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return Document{}, fmt.Errorf("%s: %w", name, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return Document{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := decodeTransfer(message.Body, message.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return Document{}, fmt.Errorf("%s: %w", name, err)
+		}
+		document, err := readHTML(name, body, message.Header.Get("Content-Type"))
+		document.URL = message.Header.Get("Snapshot-Content-Location")
+		return document, err
+	}
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return Document{}, fmt.Errorf("%s: %w", name, ErrNoHTML)
+		}
+		if err != nil {
+			return Document{}, fmt.Errorf("%s: %w", name, err)
+		}
+		contentType := part.Header.Get("Content-Type")
+		if partType, _, _ := mime.ParseMediaType(contentType); partType != "text/html" {
+			continue
+		}
+		// multipart.Reader already decodes quoted-printable parts.
+		body, err := decodeTransfer(part, part.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return Document{}, fmt.Errorf("%s: %w", name, err)
+		}
+		document, err := readHTML(name, body, contentType)
+		document.URL = part.Header.Get("Content-Location")
+		if document.URL == "" {
+			document.URL = message.Header.Get("Snapshot-Content-Location")
+		}
+		return document, err
+	}
+}
+
+func decodeTransfer(r io.Reader, transferEncoding string) ([]byte, error) {
+	if strings.EqualFold(strings.TrimSpace(transferEncoding), "base64") {
+		r = base64.NewDecoder(base64.StdEncoding, &newlineSkipper{r: r})
+	}
+	return io.ReadAll(r)
+}
+
+// newlineSkipper drops line breaks from wrapped base64.
+type newlineSkipper struct {
+	r io.Reader
+}
+
+func (s *newlineSkipper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// readZip reads every HTML and MHTML entry of a zip archive. Other entries
+// and macOS resource forks are skipped.
+func readZip(name string, data []byte) ([]Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var documents []Document
+	remaining := int64(MaxArchiveBytes)
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		switch strings.ToLower(path.Ext(entry.Name)) {
+		case ".html", ".htm", ".mhtml", ".mht":
+		default:
+			continue
+		}
+		if len(documents) == MaxArchiveFiles {
+			return nil, fmt.Errorf("%s: %w: more than %d documents", name, ErrArchiveTooLarge, MaxArchiveFiles)
+		}
+
+		file, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", name, entry.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(file, remaining+1))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", name, entry.Name, err)
+		}
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return nil, fmt.Errorf("%s: %w of %d bytes", name, ErrArchiveTooLarge, MaxArchiveBytes)
+		}
+
+		entryDocuments, err := ReadFile(name+"/"+entry.Name, content)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, entryDocuments...)
+	}
+
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoHTML)
+	}
+	return documents, nil
+}
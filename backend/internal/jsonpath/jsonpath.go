@@ -0,0 +1,394 @@
+// Package jsonpath evaluates the subset of JSONPath that extraction rules
+// use on JSON decoded with encoding/json:
+//
+//	$.offers.price                      member access
+//	$['@graph'][0]                      quoted members and array indexes
+//	$.offers[*].price, $..price         wildcards and recursive descent
+//	$[?(@['@type']=='Product')].name    filters comparing a member to a literal
+//
+// A filter compares with == or !=, or tests that a member exists. A member
+// holding an array equals a literal if any of its elements does, which
+// matches JSON-LD's "@type": ["Product", "Thing"].
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrSyntax = errors.New("invalid JSON path")
+
+type stepKind int
+
+const (
+	stepMember stepKind = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+type step struct {
+	kind      stepKind
+	name      string
+	index     int
+	recursive bool
+	filter    *filter
+}
+
+type filter struct {
+	path    []step
+	op      string
+	literal any
+}
+
+// Path is a compiled JSON path.
+type Path struct {
+	raw   string
+	steps []step
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Compile parses a JSON path starting with "$".
+func Compile(path string) (*Path, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w %q: must start with $", ErrSyntax, path)
+	}
+	p := &parser{input: path, pos: 1}
+	steps, err := p.steps(false)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrSyntax, path, err)
+	}
+	return &Path{raw: path, steps: steps}, nil
+}
+
+// Find returns the values path selects in root, in document order.
+func (p *Path) Find(root any) []any {
+	nodes := []any{root}
+	for _, s := range p.steps {
+		var next []any
+		for _, node := range nodes {
+			if s.recursive {
+				for _, descendant := range descendants(node) {
+					next = append(next, s.apply(descendant)...)
+				}
+			} else {
+				next = append(next, s.apply(node)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s step) apply(node any) []any {
+	switch s.kind {
+	case stepMember:
+		if object, ok := node.(map[string]any); ok {
+			if value, ok := object[s.name]; ok {
+				return []any{value}
+			}
+		}
+	case stepIndex:
+		if array, ok := node.([]any); ok {
+			index := s.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				return []any{array[index]}
+			}
+		}
+	case stepWildcard:
+		return children(node)
+	case stepFilter:
+		var matched []any
+		for _, child := range children(node) {
+			if s.filter.matches(child) {
+				matched = append(matched, child)
+			}
+		}
+		return matched
+	}
+	return nil
+}
+
+func (f *filter) matches(node any) bool {
+	values := (&Path{steps: f.path}).Find(node)
+	if f.op == "" {
+		return len(values) > 0
+	}
+	equal := false
+	for _, value := range values {
+		if array, ok := value.([]any); ok {
+			for _, element := range array {
+				equal = equal || element == f.literal
+			}
+		} else {
+			equal = equal || value == f.literal
+		}
+	}
+	if f.op == "!=" {
+		return len(values) > 0 && !equal
+	}
+	return equal
+}
+
+// children returns the elements of an array or the values of an object in
+// key order, so that results do not depend on map iteration.
+func children(node any) []any {
+	switch node := node.(type) {
+	case []any:
+		return node
+	case map[string]any:
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]any, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, node[key])
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns node and everything below it, depth first.
+func descendants(node any) []any {
+	result := []any{node}
+	for _, child := range children(node) {
+		result = append(result, descendants(child)...)
+	}
+	return result
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+// steps parses steps until the end of the input or, inside a filter, until
+// the closing parenthesis or comparison operator.
+func (p *parser) steps(inFilter bool) ([]step, error) {
+	var steps []step
+	for p.pos < len(p.input) {
+		if inFilter && strings.ContainsRune(")=!<> ", rune(p.input[p.pos])) {
+			break
+		}
+		recursive := false
+		switch {
+		case strings.HasPrefix(p.input[p.pos:], ".."):
+			recursive = true
+			p.pos += 2
+			if p.pos < len(p.input) && p.input[p.pos] == '[' {
+				s, err := p.bracket()
+				if err != nil {
+					return nil, err
+				}
+				s.recursive = true
+				steps = append(steps, s)
+				continue
+			}
+		case p.input[p.pos] == '.':
+			p.pos++
+		case p.input[p.pos] == '[':
+			s, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos], p.pos)
+		}
+
+		name := p.name()
+		switch name {
+		case "":
+			return nil, fmt.Errorf("missing member name at %d", p.pos)
+		case "*":
+			steps = append(steps, step{kind: stepWildcard, recursive: recursive})
+		default:
+			steps = append(steps, step{kind: stepMember, name: name, recursive: recursive})
+		}
+	}
+	return steps, nil
+}
+
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(".[)=!<> ", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) bracket() (step, error) {
+	end := p.closing()
+	if end < 0 {
+		return step{}, fmt.Errorf("unclosed [ at %d", p.pos)
+	}
+	content := strings.TrimSpace(p.input[p.pos+1 : end])
+	start := p.pos
+	p.pos = end + 1
+
+	switch {
+	case content == "*":
+		return step{kind: stepWildcard}, nil
+	case strings.HasPrefix(content, "?(") && strings.HasSuffix(content, ")"):
+		f, err := parseFilter(strings.TrimSpace(content[2 : len(content)-1]))
+		if err != nil {
+			return step{}, err
+		}
+		return step{kind: stepFilter, filter: f}, nil
+	case isQuoted(content):
+		return step{kind: stepMember, name: content[1 : len(content)-1]}, nil
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid index %q at %d", content, start)
+		}
+		return step{kind: stepIndex, index: index}, nil
+	}
+}
+
+// closing returns the position of the "]" that closes the bracket at p.pos,
+// skipping quoted strings and nested brackets.
+func (p *parser) closing() int {
+	depth := 0
+	var quote byte
+	for i := p.pos; i < len(p.input); i++ {
+		c := p.input[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseFilter(expression string) (*filter, error) {
+	if !strings.HasPrefix(expression, "@") {
+		return nil, fmt.Errorf("filter %q must start with @", expression)
+	}
+	p := &parser{input: expression, pos: 1}
+	path, err := p.steps(true)
+	if err != nil {
+		return nil, err
+	}
+	f := &filter{path: path}
+
+	rest := strings.TrimSpace(expression[p.pos:])
+	if rest == "" {
+		return f, nil
+	}
+	switch {
+	case strings.HasPrefix(rest, "=="):
+		f.op = "=="
+	case strings.HasPrefix(rest, "!="):
+		f.op = "!="
+	default:
+		return nil, fmt.Errorf("unsupported filter operator in %q", expression)
+	}
+	literal := strings.TrimSpace(rest[2:])
+	switch {
+	case isQuoted(literal):
+		f.literal = literal[1 : len(literal)-1]
+	case literal == "true" || literal == "false":
+		f.literal = literal == "true"
+	case literal == "null":
+		f.literal = nil
+	default:
+		number, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal %q", literal)
+		}
+		f.literal = number
+	}
+	return f, nil
+}
+
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
+
+// Member returns the path step selecting key, in dot notation where possible.
+func Member(key string) string {
+	for _, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			if strings.Contains(key, "'") {
+				return `["` + key + `"]`
+			}
+			return "['" + key + "']"
+		}
+	}
+	return "." + key
+}
+
+// Accessor is one step of a path in a form that code generators can walk:
+// a member, an array index or a filter on the children of the current value.
+type Accessor struct {
+	Member  string
+	Index   int
+	IsIndex bool
+	// IsFilter selects the children whose values at FilterPath compare to
+	// FilterLiteral with FilterOp ("==", "!=", or "" to test that the path
+	// exists).
+	IsFilter      bool
+	FilterPath    []string
+	FilterOp      string
+	FilterLiteral any
+}
+
+// Accessors returns the steps of the path, or false if it uses wildcards,
+// recursive descent or filters on anything but member paths.
+func (p *Path) Accessors() ([]Accessor, bool) {
+	accessors := make([]Accessor, 0, len(p.steps))
+	for _, s := range p.steps {
+		if s.recursive {
+			return nil, false
+		}
+		switch s.kind {
+		case stepMember:
+			accessors = append(accessors, Accessor{Member: s.name})
+		case stepIndex:
+			accessors = append(accessors, Accessor{Index: s.index, IsIndex: true})
+		case stepFilter:
+			members := make([]string, 0, len(s.filter.path))
+			for _, fs := range s.filter.path {
+				if fs.kind != stepMember || fs.recursive {
+					return nil, false
+				}
+				members = append(members, fs.name)
+			}
+			accessors = append(accessors, Accessor{
+				IsFilter:      true,
+				FilterPath:    members,
+				FilterOp:      s.filter.op,
+				FilterLiteral: s.filter.literal,
+			})
+		default:
+			return nil, false
+		}
+	}
+	return accessors, true
+}
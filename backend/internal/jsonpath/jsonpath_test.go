@@ -0,0 +1,133 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const productJSON = `{
+	"@context": "https://schema.org",
+	"@graph": [
+		{"@type": "Organization", "name": "Northpeak"},
+		{"@type": ["Product", "Thing"], "name": "Trail Runner 2", "sku": "TR2",
+		 "offers": [{"price": 129.99, "available": true}, {"price": 99.5, "available": false}]},
+		{"@type": "BreadcrumbList", "itemListElement": [{"name": "Shoes"}, {"name": "Running"}]}
+	],
+	"user's": "quoted"
+}`
+
+func decode(t *testing.T, data string) any {
+	t.Helper()
+	var root any
+	if err := json.Unmarshal([]byte(data), &root); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestFind(t *testing.T) {
+	root := decode(t, productJSON)
+	tests := []struct {
+		path string
+		want []any
+	}{
+		{"$['@context']", []any{"https://schema.org"}},
+		{"$['@graph'][0].name", []any{"Northpeak"}},
+		{"$['@graph'][-1]['@type']", []any{"BreadcrumbList"}},
+		{"$['@graph'][5].name", nil},
+		{`$["user's"]`, []any{"quoted"}},
+		{"$['@graph'][1].offers[*].price", []any{129.99, 99.5}},
+		{"$['@graph'][*].name", []any{"Northpeak", "Trail Runner 2"}},
+		{"$.missing.name", nil},
+
+		// Filters.
+		{"$['@graph'][?(@['@type']=='Product')].name", []any{"Trail Runner 2"}},
+		{"$['@graph'][?(@['@type'] == 'Organization')].name", []any{"Northpeak"}},
+		{`$['@graph'][?(@.sku=="TR2")].sku`, []any{"TR2"}},
+		{"$['@graph'][?(@['@type']!='Organization')]['@type']", []any{[]any{"Product", "Thing"}, "BreadcrumbList"}},
+		{"$['@graph'][?(@.offers)].name", []any{"Trail Runner 2"}},
+		{"$['@graph'][1].offers[?(@.available==true)].price", []any{129.99}},
+		{"$['@graph'][1].offers[?(@.price==99.5)].available", []any{false}},
+		{"$['@graph'][?(@.missing!='x')].name", nil},
+
+		// Recursive descent.
+		{"$..price", []any{129.99, 99.5}},
+		{"$..itemListElement[*].name", []any{"Shoes", "Running"}},
+		{"$..['sku']", []any{"TR2"}},
+		{"$..[?(@['@type']=='Product')].sku", []any{"TR2"}},
+		{"$..offers[0].price", []any{129.99}},
+		{"$..nothing", nil},
+	}
+	for _, test := range tests {
+		path, err := Compile(test.path)
+		if err != nil {
+			t.Errorf("Compile(%q) = %v", test.path, err)
+			continue
+		}
+		if got := path.Find(root); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Find(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, path := range []string{
+		"offers.price",
+		"$.offers[",
+		"$.offers[abc]",
+		"$.",
+		"$[?(price==1)]",
+		"$[?(@.price>1)]",
+		"$[?(@.price==one)]",
+	} {
+		if _, err := Compile(path); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Compile(%q) = %v, want ErrSyntax", path, err)
+		}
+	}
+}
+
+func TestMember(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"price", ".price"},
+		{"@type", "['@type']"},
+		{"user's", `["user's"]`},
+		{"two words", "['two words']"},
+	}
+	for _, test := range tests {
+		if got := Member(test.key); got != test.want {
+			t.Errorf("Member(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	path, err := Compile("$['@graph'][?(@['@type']=='Product')].offers[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := path.Accessors()
+	want := []Accessor{
+		{Member: "@graph"},
+		{IsFilter: true, FilterPath: []string{"@type"}, FilterOp: "==", FilterLiteral: "Product"},
+		{Member: "offers"},
+		{Index: 0, IsIndex: true},
+	}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Accessors() = %+v, %v, want %+v", got, ok, want)
+	}
+
+	for _, raw := range []string{"$..price", "$.offers[*].price", "$[?(@..sku)]"} {
+		path, err := Compile(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := path.Accessors(); ok {
+			t.Errorf("Accessors(%q) succeeded, want false", raw)
+		}
+	}
+}
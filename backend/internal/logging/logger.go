@@ -1,37 +1,95 @@
 package logging
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-)
+	"selectorextractor_backend/internal/config"
+	"strings"
 
-var (
-	InfoLogger  *log.Logger
-	ErrorLogger *log.Logger
+	"go.opentelemetry.io/otel/trace"
 )
 
-func InitLoggers() error {
-	// Create logs directory if it doesn't exist
-	err := os.MkdirAll("logs", 0755)
-	if err != nil {
-		return err
+// Logger is the process-wide structured logger. It writes to stderr until Init
+// is called.
+var Logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{ReplaceAttr: redact}))
+
+type requestIDKey struct{}
+
+// Init configures Logger to write leveled JSON (or text) records to stdout and
+// to a size-rotated file in cfg.Dir.
+func Init(cfg config.LogConfig) error {
+	return InitWithWriter(cfg, os.Stdout)
+}
+
+// InitWithWriter is like Init but writes to out instead of stdout.
+func InitWithWriter(cfg config.LogConfig, out io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
 	}
 
-	// Open log files
-	infoFile, err := os.OpenFile(filepath.Join("logs", "info.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		return err
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return err
+		}
+		file, err := NewRotatingFile(filepath.Join(cfg.Dir, "app.log"), int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = io.MultiWriter(out, file)
 	}
 
-	errorFile, err := os.OpenFile(filepath.Join("logs", "error.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		return err
+	options := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: redact,
 	}
 
-	// Initialize loggers
-	InfoLogger = log.New(infoFile, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(errorFile, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json", "":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return fmt.Errorf("invalid log format %q", cfg.Format)
+	}
 
+	Logger = slog.New(handler)
+	slog.SetDefault(Logger)
 	return nil
 }
+
+// WithRequestID returns a context that carries the request ID for FromContext.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns Logger annotated with the request ID and trace ID
+// stored in ctx.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := Logger
+	if requestID := RequestID(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		logger = logger.With("trace_id", spanContext.TraceID().String())
+	}
+	return logger
+}
+
+// Fatal logs msg at error level and exits the process.
+func Fatal(msg string, args ...any) {
+	Logger.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// secretKeys are attribute keys whose values are never logged.
+var secretKeys = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"x-api-key":     true,
+	"authorization": true,
+	"token":         true,
+	"secret":        true,
+	"password":      true,
+	"cookie":        true,
+}
+
+// bodyKeys are attribute keys holding documents or model output; only their
+// size is logged.
+var bodyKeys = map[string]bool{
+	"html":     true,
+	"body":     true,
+	"prompt":   true,
+	"content":  true,
+	"response": true,
+}
+
+// secretPattern matches provider keys and bearer tokens inside free text.
+var secretPattern = regexp.MustCompile(`(?i)(sk-[a-z0-9-]{8,}|bearer\s+[a-z0-9._~+/=-]+)`)
+
+// redact is a slog ReplaceAttr function that removes secrets and large bodies.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case secretKeys[key]:
+		return slog.String(a.Key, "[REDACTED]")
+	case bodyKeys[key]:
+		return slog.String(a.Key, fmt.Sprintf("[%d bytes redacted]", len(a.Value.String())))
+	}
+
+	if a.Value.Kind() == slog.KindString || a.Value.Kind() == slog.KindAny {
+		value := a.Value.String()
+		if secretPattern.MatchString(value) {
+			return slog.String(a.Key, secretPattern.ReplaceAllString(value, "[REDACTED]"))
+		}
+	}
+	return a
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "selectorextractor"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"route", "method", "status"})
+
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter by route.",
+	}, []string{"route"})
+
+	ExtractionsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "extractions_in_flight",
+		Help:      "Extraction jobs currently being processed.",
+	})
+
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of model provider calls by model.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"model"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed model provider calls by model.",
+	}, []string{"model"})
+
+	ExtractionAttempts = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "extraction_attempts",
+		Help:      "Attempts needed per extraction by model and outcome.",
+		Buckets:   []float64{1, 2, 3, 4, 5},
+	}, []string{"model", "outcome"})
+
+	Tokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Model tokens used by model and direction (input or output).",
+	}, []string{"model", "direction"})
+
+	CostUSD = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Model cost in USD by model.",
+	}, []string{"model"})
+
+	FieldValidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "field_validations_total",
+		Help:      "Server-side validation results of extracted fields by field type and result.",
+	}, []string{"type", "result"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
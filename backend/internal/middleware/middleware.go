@@ -2,66 +2,226 @@ package middleware
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/config"
 	"selectorextractor_backend/internal/logging"
+	"selectorextractor_backend/internal/metrics"
+	"selectorextractor_backend/internal/response"
+	"selectorextractor_backend/internal/tracing"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Middleware struct {
-	limiter *rate.Limiter
+	limiter *rateLimiter
 }
 
-func New(requestsPerMinute int) *Middleware {
+func New(rateLimit config.RateLimitConfig) *Middleware {
 	return &Middleware{
-		limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), requestsPerMinute),
+		limiter: newRateLimiter(rateLimit),
 	}
 }
 
+// RateLimit limits requests per client and route and reports the state of the
+// client's bucket in RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset.
+// It must run after Authenticate to limit authenticated clients by their ID.
 func (m *Middleware) RateLimit() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if !m.limiter.Allow() {
-				logging.ErrorLogger.Printf("Rate limit exceeded for IP: %s", c.RealIP())
-				return c.JSON(http.StatusTooManyRequests, map[string]string{
-					"error": "Rate limit exceeded. Please try again later.",
-				})
+			client := clientKey(c)
+			allowed, limit, remaining, reset, retryAfter := m.limiter.allow(c.Path(), client)
+			if limit > 0 {
+				header := c.Response().Header()
+				header.Set("RateLimit-Limit", strconv.Itoa(limit))
+				header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+				header.Set("RateLimit-Reset", ceilSeconds(reset))
+			}
+			if !allowed {
+				metrics.RateLimitRejections.WithLabelValues(c.Path()).Inc()
+				logging.FromContext(c.Request().Context()).Warn("Rate limit exceeded", "client", client, "route", c.Path())
+				c.Response().Header().Set("Retry-After", ceilSeconds(retryAfter))
+				return response.RateLimitError(c)
 			}
 			return next(c)
 		}
 	}
 }
 
+// IPExtractor returns how the client IP is read for rate limits and logs.
+// Without trusted proxies it is the address of the connection, since any
+// caller can send X-Forwarded-For and X-Real-IP. Otherwise X-Forwarded-For is
+// read from the right, skipping the addresses of the trusted proxies.
+func IPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// Authenticate requires a valid "Authorization: Bearer <token>" header and
+// stores the resolved client on the context. With rate limiting enabled, an
+// IP whose credentials were rejected FailedAuthLimit times within the window
+// cannot authenticate until its bucket refills.
+func (m *Middleware) Authenticate(authenticator *auth.Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				return response.Unauthorized(c, "Missing bearer token")
+			}
+			ip := "ip:" + c.RealIP()
+			throttled := m.limiter.cfg.Enabled
+			if throttled && m.limiter.exhausted(failedAuthRoute, ip) {
+				metrics.RateLimitRejections.WithLabelValues(failedAuthRoute).Inc()
+				logging.FromContext(c.Request().Context()).Warn("Too many failed authentication attempts", "ip", c.RealIP())
+				return response.RateLimitError(c)
+			}
+			client, err := authenticator.Authenticate(strings.TrimSpace(token))
+			if err != nil {
+				if throttled {
+					m.limiter.allow(failedAuthRoute, ip)
+				}
+				logging.FromContext(c.Request().Context()).Warn("Authentication failed", "ip", c.RealIP())
+				return response.Unauthorized(c, "Invalid client token")
+			}
+			auth.SetClient(c, client)
+			return next(c)
+		}
+	}
+}
+
+// RequestID assigns every request an ID (or keeps the caller's X-Request-ID),
+// echoes it in the response and stores it on the request context for logging.
+func (m *Middleware) RequestID() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			ctx := logging.WithRequestID(c.Request().Context(), requestID)
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
+	})
+}
+
 func (m *Middleware) RequestLogger() echo.MiddlewareFunc {
 	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogURI:    true,
-		LogStatus: true,
+		LogURI:     true,
+		LogStatus:  true,
+		LogLatency: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			logging.InfoLogger.Printf("REQUEST: %s %s STATUS: %d LATENCY: %v",
-				c.Request().Method, v.URI, v.Status, v.Latency)
+			logging.FromContext(c.Request().Context()).Info("Request handled",
+				"method", c.Request().Method,
+				"uri", v.URI,
+				"status", v.Status,
+				"latency", v.Latency,
+				"ip", c.RealIP(),
+			)
 			return nil
 		},
 	})
 }
 
+// Trace starts a server span for every request, continuing the caller's trace
+// when W3C trace context headers are present.
+func (m *Middleware) Trace() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := otel.Tracer("selectorextractor_backend/middleware").Start(ctx, req.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", c.Path()),
+					attribute.String("request.id", logging.RequestID(req.Context())),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			span.SetAttributes(attribute.Int("http.response.status_code", c.Response().Status))
+			if err != nil {
+				tracing.RecordError(span, err)
+			} else if c.Response().Status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(c.Response().Status))
+			}
+			return err
+		}
+	}
+}
+
+// Metrics records request counts and latencies per route, method and status.
+func (m *Middleware) Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				if httpErr, ok := err.(*echo.HTTPError); ok {
+					status = httpErr.Code
+				}
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			labels := []string{route, c.Request().Method, strconv.Itoa(status)}
+			metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
 func (m *Middleware) Recover() echo.MiddlewareFunc {
 	return middleware.RecoverWithConfig(middleware.RecoverConfig{
 		LogLevel: 0,
 		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
-			logging.ErrorLogger.Printf("PANIC RECOVERED: %v\nStack: %s", err, string(stack))
+			logging.FromContext(c.Request().Context()).Error("Panic recovered", "error", err, "stack", string(stack))
 			return nil
 		},
 	})
 }
 
+// Timeout answers 504 if the handler takes longer than timeout, and cancels
+// the request's context so that its model calls and fetches stop.
 func (m *Middleware) Timeout(timeout time.Duration) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
 			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
 
 			done := make(chan error, 1)
 			go func() {
@@ -70,7 +230,7 @@ func (m *Middleware) Timeout(timeout time.Duration) echo.MiddlewareFunc {
 
 			select {
 			case <-ctx.Done():
-				logging.ErrorLogger.Printf("Request timeout for %s %s", c.Request().Method, c.Request().URL.Path)
+				logging.FromContext(ctx).Error("Request timeout", "method", c.Request().Method, "path", c.Request().URL.Path)
 				return c.JSON(http.StatusGatewayTimeout, map[string]string{
 					"error": "Request timeout",
 				})
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"selectorextractor_backend/internal/config"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTimeoutCancelsHandler(t *testing.T) {
+	m := New(config.RateLimitConfig{})
+	e := echo.New()
+	cancelled := make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		close(cancelled)
+		return nil
+	}, m.Timeout(10*time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("handler's context was not cancelled")
+	}
+}
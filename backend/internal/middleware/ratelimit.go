@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"math"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/config"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// failedAuthRoute is the bucket route of rejected credentials, limited by
+// FailedAuthLimit per IP.
+const failedAuthRoute = "failed authentication"
+
+type bucket struct {
+	limiter  *rate.Limiter
+	limit    int
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per client and route.
+type rateLimiter struct {
+	mu      sync.Mutex
+	cfg     config.RateLimitConfig
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	l := &rateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+	}
+	if cfg.IdleTTL > 0 {
+		go l.cleanup()
+	}
+	return l
+}
+
+// cleanup periodically drops buckets that have not been used for IdleTTL.
+func (l *rateLimiter) cleanup() {
+	ticker := time.NewTicker(l.cfg.IdleTTL)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.cfg.IdleTTL {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *rateLimiter) bucketFor(route, client string, now time.Time) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := route + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		limit := l.cfg.Limit
+		if routeLimit, ok := l.cfg.Routes[route]; ok {
+			limit = routeLimit
+		}
+		if route == failedAuthRoute {
+			limit = l.cfg.FailedAuthLimit
+		}
+		burst := l.cfg.Burst
+		if burst <= 0 || burst > limit {
+			burst = limit
+		}
+		b = &bucket{
+			limiter: rate.NewLimiter(rate.Limit(float64(limit)/l.cfg.Window.Seconds()), burst),
+			limit:   limit,
+		}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b
+}
+
+// allow consumes a token for the client on route and reports the values for
+// the RateLimit-* headers. retryAfter is only meaningful when allowed is false.
+func (l *rateLimiter) allow(route, client string) (allowed bool, limit, remaining int, reset, retryAfter time.Duration) {
+	now := time.Now()
+	b := l.bucketFor(route, client, now)
+	if b.limit <= 0 {
+		return true, 0, 0, 0, 0
+	}
+
+	allowed = b.limiter.AllowN(now, 1)
+	tokens := b.limiter.TokensAt(now)
+	perSecond := float64(b.limiter.Limit())
+
+	remaining = int(math.Max(0, math.Floor(tokens)))
+	reset = time.Duration((float64(b.limiter.Burst()) - tokens) / perSecond * float64(time.Second))
+	if !allowed {
+		retryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return allowed, b.limit, remaining, reset, retryAfter
+}
+
+// exhausted reports whether the client has no token left on route, without
+// consuming one.
+func (l *rateLimiter) exhausted(route, client string) bool {
+	now := time.Now()
+	b := l.bucketFor(route, client, now)
+	return b.limit > 0 && b.limiter.TokensAt(now) < 1
+}
+
+// clientKey identifies the caller by the client Authenticate resolved, or by
+// IP address for unauthenticated requests. Unverified credentials are never
+// used, as a caller could send a new one with every request, and the IP is
+// only read from headers set by trusted proxies, see IPExtractor.
+func clientKey(c echo.Context) string {
+	if client := auth.GetClient(c); client != nil {
+		return "client:" + client.ID
+	}
+	return "ip:" + c.RealIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
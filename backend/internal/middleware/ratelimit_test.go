@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"selectorextractor_backend/internal/auth"
+	"selectorextractor_backend/internal/config"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer serves GET /limited behind RateLimit with two requests per
+// minute, and behind Authenticate as well if authenticator is set.
+func newTestServer(t *testing.T, trustedProxies []string, authenticator *auth.Authenticator) *echo.Echo {
+	t.Helper()
+	m := New(config.RateLimitConfig{Enabled: true, Limit: 2, Window: time.Minute, FailedAuthLimit: 2})
+	e := echo.New()
+	extractor, err := IPExtractor(trustedProxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.IPExtractor = extractor
+
+	middlewares := []echo.MiddlewareFunc{m.RateLimit()}
+	if authenticator != nil {
+		middlewares = append([]echo.MiddlewareFunc{m.Authenticate(authenticator)}, middlewares...)
+	}
+	e.GET("/limited", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.RealIP())
+	}, middlewares...)
+	return e
+}
+
+func get(e *echo.Echo, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	e := newTestServer(t, nil, nil)
+	codes := make([]int, 0, 3)
+	for _, spoofed := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		rec := get(e, "203.0.113.7:40000", http.Header{
+			"X-Forwarded-For": {spoofed},
+			"X-Real-Ip":       {spoofed},
+		})
+		codes = append(codes, rec.Code)
+	}
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("status codes = %v, want %v", codes, want)
+		}
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	e := newTestServer(t, []string{"10.0.0.0/8"}, nil)
+	for _, client := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		rec := get(e, "10.0.0.5:40000", http.Header{"X-Forwarded-For": {"192.0.2.99, " + client}})
+		if rec.Code != http.StatusOK || rec.Body.String() != client {
+			t.Errorf("request from %s via proxy = %d %q, want 200 with the client IP", client, rec.Code, rec.Body.String())
+		}
+	}
+
+	// An untrusted peer cannot choose its address.
+	rec := get(e, "203.0.113.7:40000", http.Header{"X-Forwarded-For": {"198.51.100.1"}})
+	if rec.Body.String() != "203.0.113.7" {
+		t.Errorf("client IP = %q, want the peer address", rec.Body.String())
+	}
+}
+
+func TestIPExtractorRejectsInvalidProxy(t *testing.T) {
+	if _, err := IPExtractor([]string{"not-an-ip"}); err == nil {
+		t.Error("IPExtractor accepted an invalid proxy")
+	}
+	if _, err := IPExtractor([]string{"10.0.0.1", "::1", "192.168.0.0/16"}); err != nil {
+		t.Errorf("IPExtractor = %v", err)
+	}
+}
+
+func TestFailedAuthenticationIsThrottled(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(tokensFile, []byte(`[{"id": "acme", "token": "valid"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.NewAuthenticator(config.AuthConfig{TokensFile: tokensFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestServer(t, nil, authenticator)
+
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if rec := get(e, "203.0.113.7:40000", bearer("guess")); rec.Code != want {
+			t.Errorf("guess %d = %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if rec := get(e, "203.0.113.7:40000", bearer("valid")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("valid token after too many guesses = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := get(e, "203.0.113.8:40000", bearer("valid")); rec.Code != http.StatusOK {
+		t.Errorf("valid token from another IP = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
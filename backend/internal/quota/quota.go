@@ -0,0 +1,154 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Limits describes how much a single client may use. Zero values mean unlimited.
+type Limits struct {
+	RequestsPerDay int     `json:"requestsPerDay,omitempty"`
+	TokensPerDay   int     `json:"tokensPerDay,omitempty"`
+	TokensPerMonth int     `json:"tokensPerMonth,omitempty"`
+	USDPerDay      float64 `json:"usdPerDay,omitempty"`
+	USDPerMonth    float64 `json:"usdPerMonth,omitempty"`
+}
+
+// Usage is an amount of model usage, either estimated or actual.
+type Usage struct {
+	Tokens int
+	USD    float64
+}
+
+// ExceededError names the limit a request would exceed.
+type ExceededError struct {
+	Limit string
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded", e.Limit)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+type window struct {
+	period   string
+	requests int
+	used     Usage
+	reserved Usage
+}
+
+func (w *window) roll(period string) {
+	if w.period != period {
+		*w = window{period: period, reserved: w.reserved}
+	}
+}
+
+type usage struct {
+	day   window
+	month window
+}
+
+// Tracker keeps in-memory usage counters per client.
+type Tracker struct {
+	mu    sync.Mutex
+	usage map[string]*usage
+	now   func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		usage: make(map[string]*usage),
+		now:   time.Now,
+	}
+}
+
+// Reservation holds estimated usage against a client's quota until the actual
+// usage is known.
+type Reservation struct {
+	tracker  *Tracker
+	clientID string
+	estimate Usage
+	once     sync.Once
+}
+
+// Reserve checks that the client can afford the estimated usage on top of what
+// it has already used and reserved, records one request and holds the estimate
+// until Commit is called.
+func (t *Tracker) Reserve(clientID string, limits Limits, estimate Usage) (*Reservation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.current(clientID)
+
+	if limits.RequestsPerDay > 0 && u.day.requests >= limits.RequestsPerDay {
+		return nil, &ExceededError{Limit: "daily request"}
+	}
+	if exceedsTokens(u.day, estimate, limits.TokensPerDay) {
+		return nil, &ExceededError{Limit: "daily token"}
+	}
+	if exceedsTokens(u.month, estimate, limits.TokensPerMonth) {
+		return nil, &ExceededError{Limit: "monthly token"}
+	}
+	if exceedsUSD(u.day, estimate, limits.USDPerDay) {
+		return nil, &ExceededError{Limit: "daily USD"}
+	}
+	if exceedsUSD(u.month, estimate, limits.USDPerMonth) {
+		return nil, &ExceededError{Limit: "monthly USD"}
+	}
+
+	u.day.requests++
+	u.month.requests++
+	for _, w := range []*window{&u.day, &u.month} {
+		w.reserved.Tokens += estimate.Tokens
+		w.reserved.USD += estimate.USD
+	}
+
+	return &Reservation{tracker: t, clientID: clientID, estimate: estimate}, nil
+}
+
+// Commit releases the reserved estimate and debits the actual usage. Calling
+// Commit more than once has no effect.
+func (r *Reservation) Commit(actual Usage) {
+	r.once.Do(func() {
+		t := r.tracker
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		u := t.current(r.clientID)
+		for _, w := range []*window{&u.day, &u.month} {
+			w.reserved.Tokens = max(0, w.reserved.Tokens-r.estimate.Tokens)
+			w.reserved.USD = max(0, w.reserved.USD-r.estimate.USD)
+			w.used.Tokens += actual.Tokens
+			w.used.USD += actual.USD
+		}
+	})
+}
+
+// current returns the client's usage with windows rolled over to the current
+// day and month. The caller must hold t.mu.
+func (t *Tracker) current(clientID string) *usage {
+	now := t.now().UTC()
+	u, ok := t.usage[clientID]
+	if !ok {
+		u = &usage{}
+		t.usage[clientID] = u
+	}
+	u.day.roll(now.Format("2006-01-02"))
+	u.month.roll(now.Format("2006-01"))
+	return u
+}
+
+func exceedsTokens(w window, estimate Usage, limit int) bool {
+	return limit > 0 && w.used.Tokens+w.reserved.Tokens+estimate.Tokens > limit
+}
+
+func exceedsUSD(w window, estimate Usage, limit float64) bool {
+	return limit > 0 && w.used.USD+w.reserved.USD+estimate.USD > limit
+}
@@ -42,6 +42,18 @@ func InternalError(c echo.Context, message string) error {
 	return ErrorWithCode(c, http.StatusInternalServerError, "INTERNAL_ERROR", message)
 }
 
+func Unauthorized(c echo.Context, message string) error {
+	return ErrorWithCode(c, http.StatusUnauthorized, "UNAUTHORIZED", message)
+}
+
+func Forbidden(c echo.Context, message string) error {
+	return ErrorWithCode(c, http.StatusForbidden, "FORBIDDEN", message)
+}
+
+func QuotaExceededError(c echo.Context, message string) error {
+	return ErrorWithCode(c, http.StatusTooManyRequests, "QUOTA_EXCEEDED", message)
+}
+
 func ValidationError(c echo.Context, message string) error {
 	return ErrorWithCode(c, http.StatusUnprocessableEntity, "VALIDATION_ERROR", message)
 }
@@ -0,0 +1,327 @@
+package selectors
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrNoNumber  = errors.New("value contains no number")
+	ErrNoDate    = errors.New("value contains no date")
+	ErrNoBoolean = errors.New("value is not a yes/no value")
+	ErrNoEmail   = errors.New("value contains no email address")
+	ErrNoPhone   = errors.New("value contains no phone number")
+	ErrNoEnum    = errors.New("value is none of the allowed values")
+)
+
+// Field types that Convert normalizes. Values of other types, including
+// "text", are returned unchanged.
+const (
+	TypeNumber   = "number"
+	TypeLink     = "link"
+	TypeImage    = "image"
+	TypeDate     = "date"
+	TypeDateTime = "datetime"
+	TypePrice    = "price"
+	TypeBoolean  = "boolean"
+	TypeEmail    = "email"
+	TypePhone    = "phone"
+	TypeEnum     = "enum"
+)
+
+// numberPattern matches a number with the separators ParseNumberWith removes.
+// Only spaces within a line group digits, so that "4.5\n(120 reviews)" ends
+// at the line break.
+var numberPattern = regexp.MustCompile(`[-+]?\d[\d.,' \x{00a0}\x{202f}]*`)
+
+// Convert turns an extracted value into the type of its field: a float64 for
+// "number", an absolute URL for "link" and "image" if base is given, an ISO
+// 8601 string for "date" and "datetime", a Price for "price", a bool for
+// "boolean", and the bare address or number for "email" and "phone". Enum
+// values are checked with MatchEnum instead, as they need the allowed values.
+// Values of any other type are returned unchanged.
+func Convert(value, fieldType string, base *url.URL) (any, error) {
+	switch fieldType {
+	case TypeNumber:
+		return ParseNumber(value)
+	case TypeLink, TypeImage:
+		return ResolveURL(value, base)
+	case TypeDate:
+		parsed, err := ParseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		return parsed.Date(), nil
+	case TypeDateTime:
+		parsed, err := ParseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		return parsed.String(), nil
+	case TypePrice:
+		return ParsePrice(value)
+	case TypeBoolean:
+		return ParseBoolean(value)
+	case TypeEmail:
+		return ParseEmail(value)
+	case TypePhone:
+		return ParsePhone(value)
+	default:
+		return value, nil
+	}
+}
+
+// ParseNumber reads the first number in value, e.g. "€ 1.299,00" or
+// "1,299.00 USD". When both "." and "," occur, the last one is the decimal
+// separator. A single separator followed by exactly three digits is taken as
+// a thousands separator, unless only a zero precedes it, as in "0.125".
+func ParseNumber(value string) (float64, error) {
+	return ParseNumberWith(value, 0)
+}
+
+// ParseNumberWith is ParseNumber with a known decimal separator, '.' or ',',
+// the other one grouping thousands. A decimal of 0 detects the separator.
+func ParseNumberWith(value string, decimal byte) (float64, error) {
+	match := strings.TrimRight(numberPattern.FindString(value), ".,' \u00a0\u202f")
+	if match == "" {
+		return 0, ErrNoNumber
+	}
+	match = strings.NewReplacer(" ", "", "'", "", "\u00a0", "", "\u202f", "").Replace(match)
+
+	lastDot, lastComma := strings.LastIndexByte(match, '.'), strings.LastIndexByte(match, ',')
+	switch {
+	case decimal != 0:
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = match[max(lastDot, lastComma)]
+	case lastDot >= 0:
+		decimal = decimalSeparator(match, '.')
+	case lastComma >= 0:
+		decimal = decimalSeparator(match, ',')
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(match); i++ {
+		switch c := match[i]; {
+		case c == decimal:
+			b.WriteByte('.')
+		case c == '.' || c == ',':
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	number, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q: %w", match, err)
+	}
+	return number, nil
+}
+
+// decimalSeparator returns sep if it is used as the decimal separator in
+// number, which contains no other separator, or 0 if it groups thousands.
+func decimalSeparator(number string, sep byte) byte {
+	if strings.Count(number, string(sep)) > 1 {
+		return 0
+	}
+	index := strings.IndexByte(number, sep)
+	if strings.TrimLeft(number[:index], "+-") == "0" {
+		return sep
+	}
+	if len(number)-index-1 == 3 {
+		return 0
+	}
+	return sep
+}
+
+// ResolveURL resolves value against base. Values that are already absolute,
+// and all values when base is nil, are returned unchanged. Links that lead
+// nowhere, such as "#" or "javascript:void(0)", are an error.
+func ResolveURL(value string, base *url.URL) (string, error) {
+	value = strings.TrimSpace(value)
+	if lower := strings.ToLower(value); lower == "#" || lower == "about:blank" || strings.HasPrefix(lower, "javascript:") {
+		return "", fmt.Errorf("%q is not a URL", value)
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if base == nil || ref.IsAbs() {
+		return ref.String(), nil
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Price is a price amount with the ISO 4217 code of its currency, which is
+// empty if the value names none.
+type Price struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+func (p Price) String() string {
+	amount := strconv.FormatFloat(p.Amount, 'f', -1, 64)
+	if p.Currency == "" {
+		return amount
+	}
+	return amount + " " + p.Currency
+}
+
+// currencyCodes are the ISO 4217 codes recognized in prices.
+var currencyCodes = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "JPY": true, "CNY": true, "CHF": true, "CAD": true, "AUD": true,
+	"NZD": true, "HKD": true, "SGD": true, "SEK": true, "NOK": true, "DKK": true, "PLN": true, "CZK": true,
+	"HUF": true, "RON": true, "BGN": true, "UAH": true, "RUB": true, "TRY": true, "INR": true, "BRL": true,
+	"MXN": true, "ZAR": true, "KRW": true, "ILS": true, "AED": true, "SAR": true, "THB": true, "VND": true,
+	"PHP": true, "IDR": true, "MYR": true,
+}
+
+// currencySymbols maps currency symbols to ISO 4217 codes. Symbols that
+// start with another symbol come first, so that "R$" is not read as "$".
+var currencySymbols = []struct{ symbol, code string }{
+	{"US$", "USD"}, {"CA$", "CAD"}, {"C$", "CAD"}, {"A$", "AUD"}, {"AU$", "AUD"}, {"NZ$", "NZD"},
+	{"HK$", "HKD"}, {"S$", "SGD"}, {"R$", "BRL"}, {"MX$", "MXN"}, {"$", "USD"},
+	{"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"}, {"₹", "INR"}, {"₽", "RUB"}, {"₴", "UAH"}, {"₺", "TRY"},
+	{"₩", "KRW"}, {"₪", "ILS"}, {"₫", "VND"}, {"₱", "PHP"}, {"฿", "THB"}, {"zł", "PLN"}, {"Kč", "CZK"},
+	{"Ft", "HUF"}, {"lei", "RON"}, {"руб", "RUB"}, {"грн", "UAH"},
+}
+
+var currencyCodePattern = regexp.MustCompile(`\b[A-Za-z]{3}\b`)
+
+// ParsePrice reads the amount of value as ParseNumber does and its currency
+// from an ISO 4217 code ("EUR 12,50") or a symbol ("12,50 €").
+func ParsePrice(value string) (Price, error) {
+	amount, err := ParseNumber(value)
+	if err != nil {
+		return Price{}, err
+	}
+	return Price{Amount: amount, Currency: currency(value)}, nil
+}
+
+func currency(value string) string {
+	for _, word := range currencyCodePattern.FindAllString(value, -1) {
+		if code := strings.ToUpper(word); currencyCodes[code] {
+			return code
+		}
+	}
+	for _, currency := range currencySymbols {
+		if containsSymbol(value, currency.symbol) {
+			return currency.code
+		}
+	}
+	return ""
+}
+
+// containsSymbol reports whether value contains symbol, as a whole word if
+// the symbol is made of letters, so that "Ft" is not found in "Gift".
+func containsSymbol(value, symbol string) bool {
+	if !unicode.IsLetter([]rune(symbol)[0]) {
+		return strings.Contains(value, symbol)
+	}
+	for start := 0; ; {
+		i := strings.Index(value[start:], symbol)
+		if i < 0 {
+			return false
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(value[:i])
+		after, _ := utf8.DecodeRuneInString(value[i+len(symbol):])
+		if !unicode.IsLetter(before) && !unicode.IsLetter(after) {
+			return true
+		}
+		start = i + len(symbol)
+	}
+}
+
+// booleans are the words read as yes or no, including schema.org
+// availability values.
+var booleans = map[string]bool{
+	"true": true, "yes": true, "y": true, "on": true, "1": true, "available": true, "in stock": true,
+	"instock": true, "limitedavailability": true, "onlineonly": true, "instoreonly": true, "preorder": true,
+	"ja": true, "oui": true, "sí": true, "si": true, "да": true, "так": true, "tak": true,
+	"false": false, "no": false, "n": false, "off": false, "0": false, "unavailable": false, "not available": false,
+	"out of stock": false, "outofstock": false, "sold out": false, "soldout": false, "discontinued": false,
+	"nein": false, "non": false, "нет": false, "ні": false, "nie": false,
+}
+
+// ParseBoolean reads yes/no values such as "Yes", "false", "In stock" or
+// "https://schema.org/OutOfStock".
+func ParseBoolean(value string) (bool, error) {
+	key := strings.ToLower(strings.Join(strings.Fields(value), " "))
+	if i := strings.LastIndexByte(key, '/'); i >= 0 && strings.Contains(key, "schema.org") {
+		key = key[i+1:]
+	}
+	key = strings.Trim(key, ".!: ")
+	if parsed, ok := booleans[key]; ok {
+		return parsed, nil
+	}
+	return false, fmt.Errorf("%w: %q", ErrNoBoolean, value)
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+// ParseEmail returns the first email address in value, e.g. in a mailto:
+// link, with its domain in lower case.
+func ParseEmail(value string) (string, error) {
+	address := emailPattern.FindString(strings.TrimPrefix(strings.TrimSpace(value), "mailto:"))
+	if address == "" {
+		return "", ErrNoEmail
+	}
+	at := strings.LastIndexByte(address, '@')
+	return address[:at] + strings.ToLower(address[at:]), nil
+}
+
+var phonePattern = regexp.MustCompile(`\+?\(?\d[\d\s().\-/\x{00a0}]{5,}\d`)
+
+// ParsePhone returns the first phone number in value, e.g. in a tel: link,
+// as its digits, with a leading "+" for international numbers written with
+// "+" or "00". Numbers must have 7 to 15 digits.
+func ParsePhone(value string) (string, error) {
+	match := phonePattern.FindString(strings.TrimPrefix(strings.TrimSpace(value), "tel:"))
+	var digits strings.Builder
+	for _, r := range match {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+	international := strings.HasPrefix(match, "+")
+	if !international && strings.HasPrefix(number, "00") {
+		number, international = number[2:], true
+	}
+	if len(number) < 7 || len(number) > 15 {
+		return "", ErrNoPhone
+	}
+	if international {
+		return "+" + number, nil
+	}
+	return number, nil
+}
+
+// MatchEnum returns the allowed value that value names, compared without
+// case and surrounding whitespace. If none equals it, the one allowed value
+// value contains as a word is used, e.g. "blue" for "Color: Blue".
+func MatchEnum(value string, allowed []string) (string, error) {
+	key := strings.ToLower(strings.Join(strings.Fields(value), " "))
+	for _, candidate := range allowed {
+		if key == strings.ToLower(strings.Join(strings.Fields(candidate), " ")) {
+			return candidate, nil
+		}
+	}
+	var found []string
+	for _, candidate := range allowed {
+		pattern := `(?i)(^|\W)` + regexp.QuoteMeta(strings.TrimSpace(candidate)) + `($|\W)`
+		if strings.TrimSpace(candidate) != "" && regexp.MustCompile(pattern).MatchString(value) {
+			found = append(found, candidate)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%w: %q is not one of %s", ErrNoEnum, strings.TrimSpace(value), strings.Join(allowed, ", "))
+}
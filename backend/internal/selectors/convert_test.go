@@ -0,0 +1,71 @@
+package selectors
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		err   error
+	}{
+		{"42", 42, nil},
+		{"-3", -3, nil},
+		{"+7.5", 7.5, nil},
+		{"12.99", 12.99, nil},
+		{"12,99", 12.99, nil},
+		{"€ 1.299,00", 1299, nil},
+		{"1,299.00 USD", 1299, nil},
+		{"1.299", 1299, nil},
+		{"1,299", 1299, nil},
+		{"1.234.567", 1234567, nil},
+		{"1,234,567", 1234567, nil},
+		{"1 299,00 €", 1299, nil},
+		{"1 299,00", 1299, nil},
+		{"1 299.50", 1299.5, nil},
+		{"CHF 1'299.50", 1299.5, nil},
+		{"0.125", 0.125, nil},
+		{"0,125", 0.125, nil},
+		{"-0.125", -0.125, nil},
+		{"10.125", 10125, nil},
+		{"1.5", 1.5, nil},
+		{"4.5\n(120 reviews)", 4.5, nil},
+		{"12,99\n inkl. MwSt.", 12.99, nil},
+		{"4,5\t", 4.5, nil},
+		{"Rating: 4.5 of 5", 4.5, nil},
+		{"Price: 19.", 19, nil},
+		{"1.299,", 1299, nil},
+		{"no digits", 0, ErrNoNumber},
+		{"", 0, ErrNoNumber},
+	}
+	for _, test := range tests {
+		got, err := ParseNumber(test.value)
+		if !errors.Is(err, test.err) || got != test.want {
+			t.Errorf("ParseNumber(%q) = %v, %v, want %v, %v", test.value, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestParseNumberWith(t *testing.T) {
+	tests := []struct {
+		value   string
+		decimal byte
+		want    float64
+	}{
+		{"1.299", ',', 1299},
+		{"1.299", '.', 1.299},
+		{"1,299", ',', 1.299},
+		{"1,299", '.', 1299},
+		{"1.299,5", ',', 1299.5},
+		{"12,5", '.', 125},
+		{"0.125", 0, 0.125},
+	}
+	for _, test := range tests {
+		got, err := ParseNumberWith(test.value, test.decimal)
+		if err != nil || got != test.want {
+			t.Errorf("ParseNumberWith(%q, %q) = %v, %v, want %v", test.value, test.decimal, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package selectors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Date is a parsed date, with the time of day and zone if the value gave
+// them.
+type Date struct {
+	Time    time.Time
+	HasTime bool
+	HasZone bool
+}
+
+// Date returns the day as YYYY-MM-DD.
+func (d Date) Date() string {
+	return d.Time.Format("2006-01-02")
+}
+
+// String returns the date and time in RFC 3339 format, without the zone if
+// the value had none and at midnight if it had no time.
+func (d Date) String() string {
+	if d.HasZone {
+		return d.Time.Format(time.RFC3339)
+	}
+	return d.Time.Format("2006-01-02T15:04:05")
+}
+
+// DateOrder says whether numeric dates such as "03/04/2024" give the day or
+// the month first.
+type DateOrder int
+
+const (
+	// DetectOrder reads the day first only when the first number is over 12,
+	// the month first only when the second is, and rejects other dates whose
+	// day and month differ.
+	DetectOrder DateOrder = iota
+	// DayFirst reads "03/04/2024" as 3 April, as most locales do.
+	DayFirst
+	// MonthFirst reads "03/04/2024" as March 4, as in the US.
+	MonthFirst
+)
+
+// ErrAmbiguousDate is returned for numeric dates whose day and month could be
+// swapped when no DateOrder is given.
+var ErrAmbiguousDate = errors.New("date could be read day or month first; give the locale in a parseDate step")
+
+// monthFirstLocales are the locales writing numeric dates month first.
+var monthFirstLocales = map[string]bool{"en-us": true, "en-ph": true}
+
+// isoLayouts are tried on the whole value before looking for dates in text.
+var isoLayouts = []struct {
+	layout  string
+	hasTime bool
+	hasZone bool
+}{
+	{time.RFC3339Nano, true, true},
+	{"2006-01-02T15:04:05Z0700", true, true},
+	{"2006-01-02T15:04:05", true, false},
+	{"2006-01-02T15:04", true, false},
+	{"2006-01-02 15:04:05", true, false},
+	{"2006-01-02 15:04", true, false},
+	{"2006-01-02", false, false},
+	{time.RFC1123Z, true, true},
+	{time.RFC1123, true, true},
+	{time.RFC850, true, true},
+	{time.ANSIC, true, false},
+}
+
+// monthNames lists the month names, or their genitive forms, of the
+// languages dates are recognized in: English, German, French, Spanish,
+// Italian, Portuguese, Dutch, Polish, Russian and Ukrainian. Abbreviations of
+// at least three letters match too.
+var monthNames = [12][]string{
+	{"january", "januar", "jänner", "janvier", "enero", "gennaio", "janeiro", "januari", "stycznia", "января", "січня"},
+	{"february", "februar", "février", "febrero", "febbraio", "fevereiro", "februari", "lutego", "февраля", "лютого"},
+	{"march", "märz", "mars", "marzo", "março", "maart", "marca", "марта", "березня"},
+	{"april", "avril", "abril", "aprile", "kwietnia", "апреля", "квітня"},
+	{"may", "mai", "mayo", "maggio", "maio", "mei", "maja", "мая", "травня"},
+	{"june", "juni", "juin", "junio", "giugno", "junho", "czerwca", "июня", "червня"},
+	{"july", "juli", "juillet", "julio", "luglio", "julho", "lipca", "июля", "липня"},
+	{"august", "août", "agosto", "augustus", "sierpnia", "августа", "серпня"},
+	{"september", "septembre", "septiembre", "setiembre", "settembre", "setembro", "września", "сентября", "вересня"},
+	{"october", "oktober", "octobre", "octubre", "ottobre", "outubro", "października", "октября", "жовтня"},
+	{"november", "novembre", "noviembre", "novembro", "listopada", "ноября", "листопада"},
+	{"december", "dezember", "décembre", "diciembre", "dicembre", "dezembro", "grudnia", "декабря", "грудня"},
+}
+
+var (
+	numericDatePattern = regexp.MustCompile(`\b(\d{1,4})([./-])(\d{1,2})([./-])(\d{2,4})\b`)
+	timePattern        = regexp.MustCompile(`(?i)\b(\d{1,2}):(\d{2})(?::(\d{2}))?(?:\s*([ap])\.?m\b\.?)?`)
+	wordPattern        = regexp.MustCompile(`\p{L}+`)
+	numberWordPattern  = regexp.MustCompile(`\d+`)
+)
+
+// ParseDate reads a date from value: ISO 8601 and RFC 1123 dates, numeric
+// dates such as "05.03.2024", "3/25/2024" or "2024/03/05", and dates with
+// month names such as "March 5, 2024" or "5. März 2024", each optionally with
+// a time like "14:30" or "2:30 pm". Numeric dates whose day and month could
+// be swapped, such as "03/04/2024", return ErrAmbiguousDate; ParseDateWith
+// reads them in a given order.
+func ParseDate(value string) (Date, error) {
+	return ParseDateWith(value, DetectOrder)
+}
+
+// ParseDateWith reads a date like ParseDate, with numeric dates in the given
+// order. Dates starting with a four-digit year are always read year, month,
+// day.
+func ParseDateWith(value string, order DateOrder) (Date, error) {
+	value = strings.TrimSpace(value)
+	original := value
+	for _, iso := range isoLayouts {
+		if parsed, err := time.Parse(iso.layout, value); err == nil {
+			return Date{Time: parsed, HasTime: iso.hasTime, HasZone: iso.hasZone}, nil
+		}
+	}
+
+	hour, minute, second, hasTime := 0, 0, 0, false
+	if match := timePattern.FindStringSubmatchIndex(value); match != nil {
+		hour, _ = strconv.Atoi(value[match[2]:match[3]])
+		minute, _ = strconv.Atoi(value[match[4]:match[5]])
+		if match[6] >= 0 {
+			second, _ = strconv.Atoi(value[match[6]:match[7]])
+		}
+		if match[8] >= 0 {
+			pm := strings.EqualFold(value[match[8]:match[9]], "p")
+			switch {
+			case pm && hour < 12:
+				hour += 12
+			case !pm && hour == 12:
+				hour = 0
+			}
+		}
+		hasTime = hour < 24 && minute < 60 && second < 60
+		if hasTime {
+			value = value[:match[0]] + " " + value[match[1]:]
+		} else {
+			hour, minute, second = 0, 0, 0
+		}
+	}
+
+	year, month, day, ok, err := numericDate(value, order)
+	if err != nil {
+		return Date{}, fmt.Errorf("%w: %q", err, original)
+	}
+	if !ok {
+		year, month, day, ok = textDate(value)
+	}
+	if !ok {
+		return Date{}, fmt.Errorf("%w: %q", ErrNoDate, original)
+	}
+	parsed := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	if parsed.Day() != day || int(parsed.Month()) != month {
+		return Date{}, fmt.Errorf("%w: %q", ErrNoDate, original)
+	}
+	return Date{Time: parsed, HasTime: hasTime}, nil
+}
+
+func numericDate(value string, order DateOrder) (year, month, day int, ok bool, err error) {
+	match := numericDatePattern.FindStringSubmatch(value)
+	if match == nil || match[2] != match[4] {
+		return 0, 0, 0, false, nil
+	}
+	a, _ := strconv.Atoi(match[1])
+	b, _ := strconv.Atoi(match[3])
+	c, _ := strconv.Atoi(match[5])
+	switch {
+	case len(match[1]) == 4:
+		year, month, day = a, b, c
+	case len(match[1]) > 2:
+		return 0, 0, 0, false, nil
+	case order == MonthFirst || order == DetectOrder && b > 12:
+		year, month, day = fullYear(c, len(match[5])), a, b
+	case order == DayFirst || a > 12 || a == b:
+		year, month, day = fullYear(c, len(match[5])), b, a
+	default:
+		return 0, 0, 0, false, ErrAmbiguousDate
+	}
+	return year, month, day, month >= 1 && month <= 12 && day >= 1 && day <= 31, nil
+}
+
+// dateOrderFor returns the order of a parseDate argument: a locale such as
+// "de" or "en-US", or "dmy" or "mdy".
+func dateOrderFor(arg string) (DateOrder, error) {
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(arg) {
+	case "":
+		return DetectOrder, nil
+	case "dmy":
+		return DayFirst, nil
+	case "mdy":
+		return MonthFirst, nil
+	}
+	if _, err := localeLanguage(arg); err != nil {
+		return DetectOrder, err
+	}
+	if monthFirstLocales[strings.ToLower(strings.ReplaceAll(arg, "_", "-"))] {
+		return MonthFirst, nil
+	}
+	return DayFirst, nil
+}
+
+// textDate reads a date with a month name: the year is the first four-digit
+// number and the day the number of at most 31 closest to the month name.
+func textDate(value string) (year, month, day int, ok bool) {
+	monthAt := -1
+	for _, word := range wordPattern.FindAllStringIndex(value, -1) {
+		if month = monthNumber(strings.ToLower(value[word[0]:word[1]])); month > 0 {
+			monthAt = word[0]
+			break
+		}
+	}
+	if month == 0 {
+		return 0, 0, 0, false
+	}
+
+	distance := -1
+	for _, number := range numberWordPattern.FindAllStringIndex(value, -1) {
+		text := value[number[0]:number[1]]
+		n, _ := strconv.Atoi(text)
+		switch {
+		case len(text) == 4 && year == 0:
+			year = n
+		case len(text) <= 2 && n >= 1 && n <= 31:
+			if d := abs(number[0] - monthAt); distance < 0 || d < distance {
+				day, distance = n, d
+			}
+		}
+	}
+	return year, month, day, year > 0 && day > 0
+}
+
+// monthNumber returns the month that word names or abbreviates, or 0.
+func monthNumber(word string) int {
+	if utf8.RuneCountInString(word) < 3 {
+		return 0
+	}
+	for i, names := range monthNames {
+		for _, name := range names {
+			if strings.HasPrefix(name, word) {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func fullYear(year, digits int) int {
+	if digits > 2 {
+		return year
+	}
+	if year < 70 {
+		return 2000 + year
+	}
+	return 1900 + year
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,85 @@
+package selectors
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   error
+	}{
+		{"2024-03-05", "2024-03-05T00:00:00", nil},
+		{"2024-03-05T14:30:00+01:00", "2024-03-05T14:30:00+01:00", nil},
+		{"Tue, 05 Mar 2024 14:30:00 GMT", "2024-03-05T14:30:00Z", nil},
+		{"2024/03/05", "2024-03-05T00:00:00", nil},
+		{"25.03.2024", "2024-03-25T00:00:00", nil},
+		{"3/25/2024", "2024-03-25T00:00:00", nil},
+		{"25-03-24", "2024-03-25T00:00:00", nil},
+		{"05.05.2024", "2024-05-05T00:00:00", nil},
+		{"03/04/2024", "", ErrAmbiguousDate},
+		{"05.03.2024", "", ErrAmbiguousDate},
+		{"March 5, 2024", "2024-03-05T00:00:00", nil},
+		{"5. März 2024, 14:30", "2024-03-05T14:30:00", nil},
+		{"Mar 5, 2024 2:30 pm", "2024-03-05T14:30:00", nil},
+		{"31.02.2024", "", ErrNoDate},
+		{"13/13/2024", "", ErrNoDate},
+		{"soon", "", ErrNoDate},
+	}
+	for _, test := range tests {
+		got, err := ParseDate(test.value)
+		if !errors.Is(err, test.err) || err == nil && got.String() != test.want {
+			t.Errorf("ParseDate(%q) = %v, %v, want %s, %v", test.value, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestParseDateWith(t *testing.T) {
+	tests := []struct {
+		value string
+		order DateOrder
+		want  string
+		err   error
+	}{
+		{"03/04/2024", DayFirst, "2024-04-03", nil},
+		{"03/04/2024", MonthFirst, "2024-03-04", nil},
+		{"05.03.2024", DayFirst, "2024-03-05", nil},
+		{"3/25/2024", MonthFirst, "2024-03-25", nil},
+		{"25/03/2024", DayFirst, "2024-03-25", nil},
+		{"25/03/2024", MonthFirst, "", ErrNoDate},
+		{"2024/03/04", DayFirst, "2024-03-04", nil},
+		{"2024/03/04", MonthFirst, "2024-03-04", nil},
+	}
+	for _, test := range tests {
+		got, err := ParseDateWith(test.value, test.order)
+		if !errors.Is(err, test.err) || err == nil && got.Date() != test.want {
+			t.Errorf("ParseDateWith(%q, %d) = %v, %v, want %s, %v", test.value, test.order, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestDateOrderFor(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    DateOrder
+		invalid bool
+	}{
+		{"", DetectOrder, false},
+		{"dmy", DayFirst, false},
+		{"MDY", MonthFirst, false},
+		{"en-US", MonthFirst, false},
+		{"en_us", MonthFirst, false},
+		{"en-GB", DayFirst, false},
+		{"de", DayFirst, false},
+		{"fr-FR", DayFirst, false},
+		{"12", DetectOrder, true},
+	}
+	for _, test := range tests {
+		got, err := dateOrderFor(test.arg)
+		if (err != nil) != test.invalid || got != test.want {
+			t.Errorf("dateOrderFor(%q) = %d, %v, want %d", test.arg, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package selectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"selectorextractor_backend/internal/jsonpath"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// ExtractMethodJSONLD reads a rule's JSONPath from the JSON-LD blocks its
+	// selector matches, usually script[type="application/ld+json"].
+	ExtractMethodJSONLD = "jsonld"
+	// ExtractMethodJSON reads a rule's JSONPath from the application state
+	// embedded in the scripts its selector matches, see ScriptJSON.
+	ExtractMethodJSON = "json"
+)
+
+// AssignmentPattern finds JSON assigned to a variable or property in inline
+// scripts, e.g. window.__INITIAL_STATE__ = {...} or window["__STATE__"]={...}.
+// The match ends at the opening bracket of the value.
+const AssignmentPattern = `([A-Za-z_$][\w$]*)["']?\]?\s*=\s*[{\[]`
+
+var assignmentPattern = regexp.MustCompile(AssignmentPattern)
+
+var (
+	ErrNoJSONPath  = errors.New("rule has no JSON path")
+	ErrInvalidJSON = errors.New("matched elements contain no valid JSON")
+	ErrNoJSONValue = errors.New("JSON path matches no value")
+)
+
+// JSONLDNodes returns the nodes of JSON-LD blocks as one array: top-level
+// objects, the elements of top-level arrays and the members of "@graph".
+// Blocks that are not valid JSON are skipped, as browsers and search engines
+// do.
+func JSONLDNodes(blocks []string) ([]any, bool) {
+	var (
+		nodes []any
+		valid bool
+	)
+	for _, block := range blocks {
+		var data any
+		if err := json.Unmarshal([]byte(block), &data); err != nil {
+			continue
+		}
+		valid = true
+		nodes = append(nodes, flattenJSONLD(data)...)
+	}
+	return nodes, valid
+}
+
+func flattenJSONLD(data any) []any {
+	switch data := data.(type) {
+	case []any:
+		var nodes []any
+		for _, element := range data {
+			nodes = append(nodes, flattenJSONLD(element)...)
+		}
+		return nodes
+	case map[string]any:
+		graph, ok := data["@graph"]
+		if !ok {
+			return []any{data}
+		}
+		return flattenJSONLD(graph)
+	}
+	return nil
+}
+
+// ScriptJSON returns the JSON embedded in a script: the whole text if it is
+// JSON, as in <script id="__NEXT_DATA__" type="application/json">, otherwise
+// an object of the JSON values the script assigns, keyed by the variable or
+// property name, e.g. {"__INITIAL_STATE__": {...}} for
+// window.__INITIAL_STATE__ = {...}. Assignments of JavaScript literals that
+// are not valid JSON are skipped.
+func ScriptJSON(text string) (any, bool) {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var data any
+		if err := json.Unmarshal([]byte(trimmed), &data); err == nil {
+			return data, true
+		}
+	}
+
+	assigned := make(map[string]any)
+	for _, match := range assignmentPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := text[match[2]:match[3]]
+		if _, ok := assigned[name]; ok {
+			continue
+		}
+		var value any
+		decoder := json.NewDecoder(strings.NewReader(text[match[1]-1:]))
+		if err := decoder.Decode(&value); err == nil {
+			assigned[name] = value
+		}
+	}
+	if len(assigned) == 0 {
+		return nil, false
+	}
+	return assigned, true
+}
+
+func readJSONLD(elements *goquery.Selection, path string) (string, error) {
+	matches, err := jsonLDMatches(elements, path)
+	if err != nil {
+		return "", err
+	}
+	if value := FirstJSONValue(matches); value != "" {
+		return value, nil
+	}
+	return "", ErrNoJSONValue
+}
+
+func readJSONLDAll(elements *goquery.Selection, path string) ([]string, error) {
+	matches, err := jsonLDMatches(elements, path)
+	if err != nil {
+		return nil, err
+	}
+	if values := JSONValues(matches); len(values) > 0 {
+		return values, nil
+	}
+	return nil, ErrNoJSONValue
+}
+
+// jsonLDMatches returns the values path selects in the JSON-LD nodes of
+// elements.
+func jsonLDMatches(elements *goquery.Selection, path string) ([]any, error) {
+	compiled, err := compilePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]string, 0, elements.Length())
+	elements.Each(func(_ int, element *goquery.Selection) {
+		blocks = append(blocks, element.Text())
+	})
+	nodes, valid := JSONLDNodes(blocks)
+	if !valid {
+		return nil, ErrInvalidJSON
+	}
+	return compiled.Find(nodes), nil
+}
+
+// readScriptJSON evaluates path against the embedded JSON of each element in
+// turn and returns the first value found.
+func readScriptJSON(elements *goquery.Selection, path string) (string, error) {
+	compiled, roots, err := scriptRoots(elements, path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if value := FirstJSONValue(compiled.Find(root)); value != "" {
+			return value, nil
+		}
+	}
+	return "", ErrNoJSONValue
+}
+
+// readScriptJSONAll evaluates path against the embedded JSON of every element
+// and returns all values found.
+func readScriptJSONAll(elements *goquery.Selection, path string) ([]string, error) {
+	compiled, roots, err := scriptRoots(elements, path)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, root := range roots {
+		values = append(values, JSONValues(compiled.Find(root))...)
+	}
+	if len(values) == 0 {
+		return nil, ErrNoJSONValue
+	}
+	return values, nil
+}
+
+// scriptRoots compiles path and returns the embedded JSON of the elements
+// that have any.
+func scriptRoots(elements *goquery.Selection, path string) (*jsonpath.Path, []any, error) {
+	compiled, err := compilePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var roots []any
+	for _, element := range elements.EachIter() {
+		if root, ok := ScriptJSON(element.Text()); ok {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, nil, ErrInvalidJSON
+	}
+	return compiled, roots, nil
+}
+
+func compilePath(path string) (*jsonpath.Path, error) {
+	if path == "" {
+		return nil, ErrNoJSONPath
+	}
+	return jsonpath.Compile(path)
+}
+
+// FirstJSONValue returns the text of the first match that is not empty.
+func FirstJSONValue(matches []any) string {
+	for _, match := range matches {
+		if value := JSONValue(match); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// JSONValues returns the text of every match that is not empty, with arrays
+// expanded into their elements.
+func JSONValues(matches []any) []string {
+	var values []string
+	for _, match := range matches {
+		elements, ok := match.([]any)
+		if !ok {
+			elements = []any{match}
+		}
+		for _, element := range elements {
+			if value := JSONValue(element); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// JSONValue returns a JSON value as text: strings as they are, numbers
+// without exponent, the first element of arrays, "@value" or "@id" of
+// JSON-LD value and reference objects and other objects as JSON.
+func JSONValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []any:
+		for _, element := range value {
+			if text := JSONValue(element); text != "" {
+				return text
+			}
+		}
+		return ""
+	case map[string]any:
+		for _, key := range []string{"@value", "@id"} {
+			if inner, ok := value[key]; ok {
+				return JSONValue(inner)
+			}
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
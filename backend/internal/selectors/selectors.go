@@ -0,0 +1,225 @@
+package selectors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+var (
+	ErrNoSelector = errors.New("rule has no selector")
+	ErrNoMatch    = errors.New("selector matches no element")
+)
+
+// Rule describes how a single value is read from a document: the first element
+// matching Selector, read via AttributeToGet or ExtractMethod, then optionally
+// narrowed down or cleaned up with Regex. With ExtractMethod "jsonld" or "json"
+// the value is read with JSONPath from the JSON-LD or the embedded application
+// state of all matching elements instead. ApplyAll reads a list of values with
+// the same rule.
+type Rule struct {
+	Selector             string
+	AttributeToGet       string
+	ExtractMethod        string
+	JSONPath             string
+	Regex                string
+	RegexMatchIndexToUse int
+	RegexUse             string
+}
+
+// Parse parses an HTML document for use with Apply.
+func Parse(html string) (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(strings.NewReader(html))
+}
+
+// Apply executes rule against doc and returns the extracted value.
+func Apply(doc *goquery.Document, rule Rule) (string, error) {
+	if rule.Selector == "" {
+		return "", ErrNoSelector
+	}
+	return ApplyIn(doc.Selection, rule)
+}
+
+// ApplyIn is Apply within scope, as for the child fields of a record: the
+// selector matches descendants of scope, and an empty selector reads the
+// first element of scope itself.
+func ApplyIn(scope *goquery.Selection, rule Rule) (string, error) {
+	elements, err := Select(scope, rule.Selector)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch rule.ExtractMethod {
+	case ExtractMethodJSONLD:
+		value, err = readJSONLD(elements, rule.JSONPath)
+	case ExtractMethodJSON:
+		value, err = readScriptJSON(elements, rule.JSONPath)
+	default:
+		value, err = readValue(elements.First(), rule)
+	}
+	if err != nil {
+		return "", err
+	}
+	return finish(value, rule)
+}
+
+// ApplyAll executes rule against doc and returns the values of all matching
+// elements in document order, or for JSON rules every value the path selects
+// with arrays expanded into their elements. Values that are empty after the
+// regex are left out.
+func ApplyAll(doc *goquery.Document, rule Rule) ([]string, error) {
+	if rule.Selector == "" {
+		return nil, ErrNoSelector
+	}
+	return ApplyAllIn(doc.Selection, rule)
+}
+
+// ApplyAllIn is ApplyAll within scope, see ApplyIn.
+func ApplyAllIn(scope *goquery.Selection, rule Rule) ([]string, error) {
+	elements, err := Select(scope, rule.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []string
+	switch rule.ExtractMethod {
+	case ExtractMethodJSONLD:
+		raw, err = readJSONLDAll(elements, rule.JSONPath)
+	case ExtractMethodJSON:
+		raw, err = readScriptJSONAll(elements, rule.JSONPath)
+	default:
+		for _, element := range elements.EachIter() {
+			value, err := readValue(element, rule)
+			if err != nil {
+				return nil, err
+			}
+			raw = append(raw, value)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(raw))
+	for _, value := range raw {
+		value, err := finish(value, rule)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// Select returns the descendants of scope matching selector, or scope itself
+// for an empty selector.
+func Select(scope *goquery.Selection, selector string) (*goquery.Selection, error) {
+	if selector == "" {
+		if scope.Length() == 0 {
+			return nil, ErrNoMatch
+		}
+		return scope, nil
+	}
+
+	matcher, err := cascadia.Compile(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	elements := scope.FindMatcher(matcher)
+	if elements.Length() == 0 {
+		return nil, ErrNoMatch
+	}
+	return elements, nil
+}
+
+// CheckRule reports whether rule has a selector and whether its selector and
+// regex compile, without applying it to a document.
+func CheckRule(rule Rule) error {
+	if rule.Selector == "" {
+		return ErrNoSelector
+	}
+	if _, err := cascadia.Compile(rule.Selector); err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	if rule.Regex != "" {
+		if _, err := CompileRegex(rule.Regex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish applies the rule's regex to a value read from the document and trims
+// the result.
+func finish(value string, rule Rule) (string, error) {
+	if rule.Regex != "" {
+		var err error
+		value, err = applyRegex(value, rule)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSpace(value), nil
+}
+
+func readValue(element *goquery.Selection, rule Rule) (string, error) {
+	if rule.AttributeToGet != "" {
+		return Attribute(element, rule.AttributeToGet), nil
+	}
+
+	switch rule.ExtractMethod {
+	case "innerHTML":
+		return element.Html()
+	case "innerText":
+		// innerText only returns rendered text; without a layout engine the
+		// closest approximation is the text content with collapsed whitespace.
+		return strings.Join(strings.Fields(element.Text()), " "), nil
+	default:
+		return element.Text(), nil
+	}
+}
+
+// applyRegex mirrors the JavaScript semantics the prompt asks the model for:
+// "extract" returns String.match()[RegexMatchIndexToUse], "omit" removes the
+// first match from the value.
+func applyRegex(value string, rule Rule) (string, error) {
+	re, err := CompileRegex(rule.Regex)
+	if err != nil {
+		return "", err
+	}
+
+	if rule.RegexUse == "omit" {
+		loc := re.FindStringIndex(value)
+		if loc == nil {
+			return value, nil
+		}
+		return value[:loc[0]] + value[loc[1]:], nil
+	}
+
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return "", nil
+	}
+	if rule.RegexMatchIndexToUse < 0 || rule.RegexMatchIndexToUse >= len(match) {
+		return "", fmt.Errorf("regex match index %d out of range", rule.RegexMatchIndexToUse)
+	}
+	return match[rule.RegexMatchIndexToUse], nil
+}
+
+// CompileRegex compiles an ECMAScript-style regex with Go's RE2 engine.
+// Lookarounds and backreferences are not supported and return an error.
+func CompileRegex(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,208 @@
+package selectors
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Post-processing operations, run in order on the value a rule extracted.
+const (
+	// StepTrim removes leading and trailing whitespace.
+	StepTrim = "trim"
+	// StepCollapseWhitespace replaces runs of whitespace with one space.
+	StepCollapseWhitespace = "collapseWhitespace"
+	// StepParseNumber reads the first number of the value. Arg is a locale
+	// such as "de" or "en-US", or the decimal separator "." or ","; an empty
+	// Arg detects the separator as ParseNumber does.
+	StepParseNumber = "parseNumber"
+	// StepParseDate reads the date of the value and returns it in ISO 8601.
+	// Arg is a locale such as "de" or "en-US", or "dmy" or "mdy", giving the
+	// order of numeric dates; an empty Arg reads them as ParseDate does.
+	StepParseDate = "parseDate"
+	// StepStripUnit removes the unit Arg, e.g. "km", without regard to case,
+	// or with an empty Arg everything after the last digit.
+	StepStripUnit = "stripUnit"
+	// StepScale multiplies a number by Arg, e.g. "1000" or "0.01".
+	StepScale = "scale"
+	// StepToAbsoluteURL resolves the value against the document's base URL,
+	// or Arg if there is none.
+	StepToAbsoluteURL = "toAbsoluteUrl"
+)
+
+var ErrUnknownStep = errors.New("unknown step")
+
+// Step is one post-processing operation with its argument, "" if it takes
+// none.
+type Step struct {
+	Op  string `json:"op" enum:"trim,collapseWhitespace,parseNumber,parseDate,stripUnit,scale,toAbsoluteUrl"`
+	Arg string `json:"arg" description:"parseNumber: locale or decimal separator; parseDate: locale or day/month order (dmy, mdy); stripUnit: the unit; scale: the factor; toAbsoluteUrl: fallback base URL; otherwise empty"`
+}
+
+// commaDecimalLanguages are the languages of locales writing 1.234,56.
+var commaDecimalLanguages = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "pt": true, "nl": true, "pl": true, "ru": true, "uk": true,
+	"cs": true, "sk": true, "sv": true, "da": true, "nb": true, "no": true, "fi": true, "tr": true, "id": true,
+	"ro": true, "hu": true, "bg": true, "hr": true, "sl": true, "sr": true, "el": true, "lt": true, "lv": true,
+	"et": true, "vi": true,
+}
+
+var lastDigitPattern = regexp.MustCompile(`^.*\d`)
+
+// RunSteps applies steps to value in order. The result is a string, or a
+// float64 once parseNumber or scale ran; a step that needs text turns a
+// number back into text, and scale parses text as ParseNumber does.
+func RunSteps(value string, steps []Step, base *url.URL) (any, error) {
+	var result any = value
+	for i, step := range steps {
+		var err error
+		result, err = runStep(result, step, base)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Op, err)
+		}
+	}
+	return result, nil
+}
+
+func runStep(value any, step Step, base *url.URL) (any, error) {
+	text, isText := value.(string)
+	if !isText {
+		text = strconv.FormatFloat(value.(float64), 'f', -1, 64)
+	}
+
+	switch step.Op {
+	case StepTrim:
+		return strings.TrimSpace(text), nil
+	case StepCollapseWhitespace:
+		return strings.Join(strings.Fields(text), " "), nil
+	case StepParseNumber:
+		if !isText {
+			return value, nil
+		}
+		decimal, err := decimalFor(step.Arg)
+		if err != nil {
+			return nil, err
+		}
+		return ParseNumberWith(text, decimal)
+	case StepParseDate:
+		order, err := dateOrderFor(step.Arg)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ParseDateWith(text, order)
+		if err != nil {
+			return nil, err
+		}
+		if !parsed.HasTime {
+			return parsed.Date(), nil
+		}
+		return parsed.String(), nil
+	case StepStripUnit:
+		if step.Arg == "" {
+			return strings.TrimSpace(lastDigitPattern.FindString(text)), nil
+		}
+		pattern := regexp.MustCompile(`(?i)\s*` + regexp.QuoteMeta(strings.TrimSpace(step.Arg)))
+		return strings.TrimSpace(pattern.ReplaceAllString(text, "")), nil
+	case StepScale:
+		factor, err := strconv.ParseFloat(strings.TrimSpace(step.Arg), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid factor %q", step.Arg)
+		}
+		number, _ := value.(float64)
+		if isText {
+			if number, err = ParseNumber(text); err != nil {
+				return nil, err
+			}
+		}
+		return number * factor, nil
+	case StepToAbsoluteURL:
+		if base == nil && step.Arg != "" {
+			parsed, err := url.Parse(step.Arg)
+			if err != nil || !parsed.IsAbs() {
+				return nil, fmt.Errorf("invalid base URL %q", step.Arg)
+			}
+			base = parsed
+		}
+		return ResolveURL(text, base)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownStep, step.Op)
+	}
+}
+
+// ConvertNumber turns a number produced by steps into the field type: the
+// number itself for number fields, a Price in the currency raw names for
+// price fields, and otherwise its text converted by Convert.
+func ConvertNumber(number float64, raw, fieldType string, base *url.URL) (any, error) {
+	switch fieldType {
+	case TypeNumber:
+		return number, nil
+	case TypePrice:
+		return Price{Amount: number, Currency: currency(raw)}, nil
+	}
+	return Convert(strconv.FormatFloat(number, 'f', -1, 64), fieldType, base)
+}
+
+// CheckSteps reports the first step with an unknown operation or invalid
+// argument.
+func CheckSteps(steps []Step) error {
+	for i, step := range steps {
+		var err error
+		switch step.Op {
+		case StepTrim, StepCollapseWhitespace, StepStripUnit:
+		case StepParseNumber:
+			_, err = decimalFor(step.Arg)
+		case StepParseDate:
+			_, err = dateOrderFor(step.Arg)
+		case StepScale:
+			if _, parseErr := strconv.ParseFloat(strings.TrimSpace(step.Arg), 64); parseErr != nil {
+				err = fmt.Errorf("invalid factor %q", step.Arg)
+			}
+		case StepToAbsoluteURL:
+			if step.Arg != "" {
+				if parsed, parseErr := url.Parse(step.Arg); parseErr != nil || !parsed.IsAbs() {
+					err = fmt.Errorf("invalid base URL %q", step.Arg)
+				}
+			}
+		default:
+			err = fmt.Errorf("%w %q", ErrUnknownStep, step.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Op, err)
+		}
+	}
+	return nil
+}
+
+// decimalFor returns the decimal separator of a parseNumber argument, or 0 to
+// detect it.
+func decimalFor(arg string) (byte, error) {
+	arg = strings.TrimSpace(arg)
+	switch arg {
+	case "":
+		return 0, nil
+	case ".", ",":
+		return arg[0], nil
+	}
+	language, err := localeLanguage(arg)
+	if err != nil {
+		return 0, err
+	}
+	// Swiss German writes 1'234.56.
+	if commaDecimalLanguages[language] && !strings.EqualFold(arg, "de-CH") {
+		return ',', nil
+	}
+	return '.', nil
+}
+
+// localeLanguage returns the lower-case language of a locale such as "de" or
+// "en_US".
+func localeLanguage(locale string) (string, error) {
+	language, _, _ := strings.Cut(strings.ToLower(strings.ReplaceAll(locale, "_", "-")), "-")
+	if len(language) < 2 || len(language) > 3 || strings.Trim(language, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return "", fmt.Errorf("invalid locale %q", locale)
+	}
+	return language, nil
+}
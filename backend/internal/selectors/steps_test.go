@@ -0,0 +1,131 @@
+package selectors
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestRunSteps(t *testing.T) {
+	base, _ := url.Parse("https://shop.example/p/1")
+	tests := []struct {
+		value   string
+		steps   []Step
+		base    *url.URL
+		want    any
+		invalid bool
+	}{
+		{"  Trail Runner  ", []Step{{Op: StepTrim}}, nil, "Trail Runner", false},
+		{" Trail \n\t Runner 2 ", []Step{{Op: StepCollapseWhitespace}}, nil, "Trail Runner 2", false},
+
+		{"1.299,50 €", []Step{{Op: StepParseNumber}}, nil, 1299.5, false},
+		{"1.299", []Step{{Op: StepParseNumber, Arg: "de"}}, nil, 1299.0, false},
+		{"1.299", []Step{{Op: StepParseNumber, Arg: "en-US"}}, nil, 1.299, false},
+		{"1,299", []Step{{Op: StepParseNumber, Arg: ","}}, nil, 1.299, false},
+		{"CHF 1'299.50", []Step{{Op: StepParseNumber, Arg: "de-CH"}}, nil, 1299.5, false},
+		{"no price", []Step{{Op: StepParseNumber}}, nil, nil, true},
+		{"12", []Step{{Op: StepParseNumber, Arg: "12"}}, nil, nil, true},
+
+		{"03/04/2024", []Step{{Op: StepParseDate, Arg: "en-GB"}}, nil, "2024-04-03", false},
+		{"03/04/2024", []Step{{Op: StepParseDate, Arg: "en-US"}}, nil, "2024-03-04", false},
+		{"03/04/2024 14:30", []Step{{Op: StepParseDate, Arg: "dmy"}}, nil, "2024-04-03T14:30:00", false},
+		{"03/04/2024", []Step{{Op: StepParseDate}}, nil, nil, true},
+
+		{"80.692 km", []Step{{Op: StepStripUnit, Arg: "KM"}}, nil, "80.692", false},
+		{"12 kg (net)", []Step{{Op: StepStripUnit}}, nil, "12", false},
+
+		{"1,5", []Step{{Op: StepScale, Arg: "1000"}}, nil, 1500.0, false},
+		{"1299", []Step{{Op: StepParseNumber}, {Op: StepScale, Arg: "0.01"}}, nil, 12.99, false},
+		{"1", []Step{{Op: StepScale, Arg: "ten"}}, nil, nil, true},
+
+		{"/img/1.jpg", []Step{{Op: StepToAbsoluteURL}}, base, "https://shop.example/img/1.jpg", false},
+		{"/img/1.jpg", []Step{{Op: StepToAbsoluteURL, Arg: "https://cdn.example"}}, nil, "https://cdn.example/img/1.jpg", false},
+		{"/img/1.jpg", []Step{{Op: StepToAbsoluteURL, Arg: "https://cdn.example"}}, base, "https://shop.example/img/1.jpg", false},
+		{"/img/1.jpg", []Step{{Op: StepToAbsoluteURL, Arg: "/relative"}}, nil, nil, true},
+
+		// A step needing text gets a number back as text.
+		{"Qty: 1.000", []Step{{Op: StepParseNumber, Arg: "de"}, {Op: StepTrim}}, nil, "1000", false},
+		{"x", []Step{{Op: "uppercase"}}, nil, nil, true},
+	}
+	for _, test := range tests {
+		got, err := RunSteps(test.value, test.steps, test.base)
+		if (err != nil) != test.invalid || got != test.want {
+			t.Errorf("RunSteps(%q, %v) = %v, %v, want %v", test.value, test.steps, got, err, test.want)
+		}
+	}
+}
+
+func TestRunStepsReportsFailingStep(t *testing.T) {
+	_, err := RunSteps("x", []Step{{Op: StepTrim}, {Op: "uppercase"}}, nil)
+	if !errors.Is(err, ErrUnknownStep) || err.Error() != `step 2 (uppercase): unknown step "uppercase"` {
+		t.Errorf("RunSteps error = %v", err)
+	}
+}
+
+func TestCheckSteps(t *testing.T) {
+	tests := []struct {
+		steps   []Step
+		invalid bool
+	}{
+		{nil, false},
+		{[]Step{{Op: StepTrim}, {Op: StepCollapseWhitespace}, {Op: StepStripUnit, Arg: "km"}}, false},
+		{[]Step{{Op: StepParseNumber, Arg: "fr"}, {Op: StepScale, Arg: "0.001"}}, false},
+		{[]Step{{Op: StepParseDate, Arg: "mdy"}, {Op: StepToAbsoluteURL, Arg: "https://shop.example"}}, false},
+		{[]Step{{Op: StepParseNumber, Arg: "1"}}, true},
+		{[]Step{{Op: StepParseDate, Arg: "d/m/y"}}, true},
+		{[]Step{{Op: StepScale}}, true},
+		{[]Step{{Op: StepToAbsoluteURL, Arg: "shop.example"}}, true},
+		{[]Step{{Op: "regex"}}, true},
+	}
+	for _, test := range tests {
+		if err := CheckSteps(test.steps); (err != nil) != test.invalid {
+			t.Errorf("CheckSteps(%v) = %v, want invalid %v", test.steps, err, test.invalid)
+		}
+	}
+}
+
+func TestDecimalFor(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    byte
+		invalid bool
+	}{
+		{"", 0, false},
+		{".", '.', false},
+		{",", ',', false},
+		{"de", ',', false},
+		{"de_AT", ',', false},
+		{"de-CH", '.', false},
+		{"en-US", '.', false},
+		{"pt-BR", ',', false},
+		{"ja", '.', false},
+		{"d", 0, true},
+		{"1,5", 0, true},
+	}
+	for _, test := range tests {
+		got, err := decimalFor(test.arg)
+		if (err != nil) != test.invalid || got != test.want {
+			t.Errorf("decimalFor(%q) = %q, %v, want %q", test.arg, got, err, test.want)
+		}
+	}
+}
+
+func TestConvertNumber(t *testing.T) {
+	tests := []struct {
+		number    float64
+		raw       string
+		fieldType string
+		want      any
+	}{
+		{1299, "1.299 €", TypeNumber, 1299.0},
+		{1299, "1.299 €", TypePrice, Price{Amount: 1299, Currency: "EUR"}},
+		{12.5, "$12.50", TypePrice, Price{Amount: 12.5, Currency: "USD"}},
+		{42, "42 pcs", "text", "42"},
+	}
+	for _, test := range tests {
+		got, err := ConvertNumber(test.number, test.raw, test.fieldType, nil)
+		if err != nil || got != test.want {
+			t.Errorf("ConvertNumber(%v, %q, %s) = %v, %v, want %v", test.number, test.raw, test.fieldType, got, err, test.want)
+		}
+	}
+}
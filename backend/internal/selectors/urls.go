@@ -0,0 +1,155 @@
+package selectors
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// lazyAttributes are the attributes lazy loading scripts move the real URL
+// out of, in the order they are tried when the attribute a rule reads is
+// empty or a placeholder. Srcset attributes give their largest candidate.
+var lazyAttributes = map[string][]string{
+	"src":    {"data-src", "data-lazy-src", "data-original", "data-lazy", "data-url", "data-srcset", "data-lazy-srcset", "srcset"},
+	"srcset": {"data-srcset", "data-lazy-srcset"},
+	"href":   {"data-href", "data-url"},
+}
+
+// Attribute reads the attribute name of element. Srcset attributes give the
+// URL of their largest candidate, and src, srcset and href fall back to the
+// attributes of lazy loading scripts (data-src, data-srcset, data-href, …)
+// when they are missing, empty or a placeholder such as a data: URI.
+func Attribute(element *goquery.Selection, name string) string {
+	value := attributeValue(element, name)
+	if !isPlaceholder(value) {
+		return value
+	}
+	for _, lazy := range lazyAttributes[strings.ToLower(name)] {
+		if candidate := attributeValue(element, lazy); !isPlaceholder(candidate) {
+			return candidate
+		}
+	}
+	return value
+}
+
+func attributeValue(element *goquery.Selection, name string) string {
+	value, _ := element.Attr(name)
+	if strings.HasSuffix(strings.ToLower(name), "srcset") {
+		return LargestSrcset(value)
+	}
+	return value
+}
+
+// isPlaceholder reports whether value stands in for a URL that is not loaded
+// yet.
+func isPlaceholder(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "" || value == "#" || value == "about:blank" ||
+		strings.HasPrefix(value, "data:") || strings.HasPrefix(value, "javascript:")
+}
+
+// LargestSrcset returns the URL of the largest candidate of a srcset
+// attribute: the widest if candidates have width descriptors ("640w"),
+// otherwise the one with the highest pixel density ("2x").
+func LargestSrcset(srcset string) string {
+	var (
+		best      string
+		bestWidth float64
+		bestX     float64
+	)
+	for _, candidate := range parseSrcset(srcset) {
+		switch {
+		case candidate.width > bestWidth:
+			best, bestWidth = candidate.url, candidate.width
+		case bestWidth == 0 && candidate.width == 0 && candidate.density > bestX:
+			best, bestX = candidate.url, candidate.density
+		}
+	}
+	return best
+}
+
+type srcsetCandidate struct {
+	url     string
+	width   float64
+	density float64
+}
+
+// parseSrcset splits a srcset attribute into its candidates. URLs may
+// contain commas; a candidate ends at the first comma after its URL.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return candidates
+		}
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end < 0 {
+			end = len(rest)
+		}
+		candidate := srcsetCandidate{url: rest[:end], density: 1}
+		rest = rest[end:]
+
+		if trimmed := strings.TrimRight(candidate.url, ","); trimmed != candidate.url {
+			// A URL ending in commas has no descriptors.
+			candidate.url = trimmed
+		} else {
+			descriptors := rest
+			if comma := strings.IndexByte(rest, ','); comma >= 0 {
+				descriptors, rest = rest[:comma], rest[comma+1:]
+			} else {
+				rest = ""
+			}
+			for _, descriptor := range strings.Fields(descriptors) {
+				number, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+				if err != nil || number <= 0 {
+					continue
+				}
+				switch descriptor[len(descriptor)-1] {
+				case 'w':
+					candidate.width = number
+				case 'x':
+					candidate.density = number
+				}
+			}
+		}
+		if candidate.url != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+// BaseURL returns the URL relative links in doc resolve against, as a
+// browser would: the href of the document's first <base> element resolved
+// against documentURL, or documentURL itself. It returns nil if neither is
+// an absolute URL, and an error if documentURL is set but not absolute.
+func BaseURL(doc *goquery.Document, documentURL string) (*url.URL, error) {
+	var document *url.URL
+	if documentURL != "" {
+		parsed, err := url.Parse(documentURL)
+		if err != nil || !parsed.IsAbs() {
+			return nil, fmt.Errorf("invalid base URL %q", documentURL)
+		}
+		document = parsed
+	}
+
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return document, nil
+	}
+	base, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return document, nil
+	}
+	if document != nil {
+		base = document.ResolveReference(base)
+	}
+	if !base.IsAbs() {
+		return document, nil
+	}
+	return base, nil
+}
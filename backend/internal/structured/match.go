@@ -0,0 +1,257 @@
+package structured
+
+import (
+	"fmt"
+	"selectorextractor_backend/internal/selectors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxMatches is the number of candidate sources suggested per field.
+	maxMatches = 3
+	// maxDescribedSources and maxDescribedValue bound the prompt section.
+	maxDescribedSources = 80
+	maxDescribedValue   = 100
+)
+
+// synonyms lists keys of schema.org and OpenGraph that commonly hold a field
+// of the given (normalized) name.
+var synonyms = map[string][]string{
+	"title":        {"name", "headline"},
+	"name":         {"title", "headline"},
+	"headline":     {"name", "title"},
+	"price":        {"lowprice", "priceamount"},
+	"currency":     {"pricecurrency"},
+	"image":        {"contenturl", "thumbnailurl", "imageurl", "thumbnail"},
+	"picture":      {"image", "imageurl"},
+	"photo":        {"image", "imageurl"},
+	"link":         {"url"},
+	"rating":       {"ratingvalue"},
+	"reviews":      {"reviewcount", "ratingcount"},
+	"reviewcount":  {"ratingcount"},
+	"author":       {"creator"},
+	"date":         {"datepublished", "publishedtime", "datecreated"},
+	"published":    {"datepublished", "publishedtime"},
+	"stock":        {"availability"},
+	"summary":      {"description"},
+	"sku":          {"mpn", "productid", "gtin13", "gtin"},
+	"manufacturer": {"brand"},
+}
+
+// siteTypes describe the site rather than the page's main entity; their
+// values lose ties against other nodes.
+var siteTypes = map[string]bool{"Organization": true, "Corporation": true, "WebSite": true, "WebPage": true, "BreadcrumbList": true, "SiteNavigationElement": true, "WPHeader": true, "WPFooter": true}
+
+// genericKeys name a value of their parent, e.g. brand.name is the brand.
+var genericKeys = map[string]bool{"name": true, "value": true, "url": true, "amount": true, "content": true, "text": true, "id": true}
+
+// Field is a requested field as far as matching is concerned.
+type Field struct {
+	Name string
+	Type string
+}
+
+// Match returns up to three sources that likely hold field, best first. A
+// source matches if its key, or its parent's key for generic keys like
+// "name", equals the field name or a synonym of it and its value fits the
+// field type. Ties go to JSON-LD over microdata, RDFa, embedded state and
+// OpenGraph, then to
+// the page's own entities over site-wide ones and to shallower keys.
+func Match(sources []Source, field Field) []Source {
+	terms := matchTerms(field.Name)
+	type candidate struct {
+		source Source
+		rank   int
+		order  int
+	}
+	var candidates []candidate
+	for i, source := range sources {
+		rank, ok := termRank(sourceKeys(source), terms)
+		if !ok || !fitsType(source.Value, field.Type) {
+			continue
+		}
+		candidates = append(candidates, candidate{source: source, rank: rank, order: i})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if kindOrder[a.source.Kind] != kindOrder[b.source.Kind] {
+			return kindOrder[a.source.Kind] < kindOrder[b.source.Kind]
+		}
+		if siteTypes[a.source.segments[0]] != siteTypes[b.source.segments[0]] {
+			return !siteTypes[a.source.segments[0]]
+		}
+		if len(a.source.segments) != len(b.source.segments) {
+			return len(a.source.segments) < len(b.source.segments)
+		}
+		return a.order < b.order
+	})
+
+	matches := make([]Source, 0, maxMatches)
+	for _, c := range candidates[:min(len(candidates), maxMatches)] {
+		matches = append(matches, c.source)
+	}
+	return matches
+}
+
+// matchTerms returns the normalized field name, its synonyms, and the same
+// for the last word of the name, e.g. "title" for "productTitle".
+func matchTerms(name string) []string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return nil
+	}
+	full := strings.Join(words, "")
+	terms := append([]string{full}, synonyms[full]...)
+	if last := words[len(words)-1]; last != full {
+		terms = append(terms, last)
+		terms = append(terms, synonyms[last]...)
+	}
+	return terms
+}
+
+func termRank(keys, terms []string) (int, bool) {
+	for rank, term := range terms {
+		for _, key := range keys {
+			if key == term {
+				return rank, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// sourceKeys returns the normalized names a source can match: its last key,
+// and for generic last keys the parent alone and combined with the key.
+func sourceKeys(source Source) []string {
+	if len(source.segments) == 0 {
+		return nil
+	}
+	last := normalize(source.segments[len(source.segments)-1])
+	keys := []string{last}
+	if len(source.segments) > 1 {
+		parent := normalize(source.segments[len(source.segments)-2])
+		keys = append(keys, parent+last)
+		if genericKeys[last] {
+			keys = append(keys, parent)
+		}
+	}
+	return keys
+}
+
+func fitsType(value, fieldType string) bool {
+	if strings.HasPrefix(value, "{") {
+		return false
+	}
+	switch fieldType {
+	case selectors.TypeLink, selectors.TypeImage:
+		return !strings.ContainsAny(value, " \t\n") && strings.ContainsAny(value, "/.")
+	case selectors.TypeEnum:
+		return true
+	}
+	_, err := selectors.Convert(value, fieldType, nil)
+	return err == nil
+}
+
+func normalize(s string) string {
+	return strings.Join(splitWords(s), "")
+}
+
+// splitWords splits camelCase, snake_case and other separated names into
+// lower-case words.
+func splitWords(s string) []string {
+	var (
+		words   []string
+		current []rune
+	)
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			current = append(current, unicode.ToLower(r))
+		default:
+			current = append(current, unicode.ToLower(r))
+		}
+	}
+	flush()
+	return words
+}
+
+// Describe lists sources for the prompt: every structured data value with the
+// rule that reads it, the shape of each embedded state, and the likely
+// matches for each requested field. It returns "" if the page has neither.
+func Describe(sources []Source, states []State, fields []Field) string {
+	var b strings.Builder
+	described := 0
+	for _, source := range sources {
+		if source.Kind == KindState {
+			continue
+		}
+		if described++; described <= maxDescribedSources {
+			fmt.Fprintf(&b, "- %s %s = %q; %s\n", source.Kind, source.Key, shorten(source.Value, maxDescribedValue), describeRule(source.Rule))
+		}
+	}
+	if described > maxDescribedSources {
+		fmt.Fprintf(&b, "- … %d more values omitted\n", described-maxDescribedSources)
+	}
+	for _, state := range states {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Embedded state in ")
+		b.WriteString(describeState(state))
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+
+	var matched strings.Builder
+	for _, field := range fields {
+		matches := Match(sources, field)
+		if len(matches) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(matches))
+		for _, match := range matches {
+			key := match.Kind + " " + match.Key
+			if match.Kind == KindState {
+				key += " in " + match.Rule.Selector
+			}
+			keys = append(keys, key)
+		}
+		fmt.Fprintf(&matched, "- %s: %s\n", field.Name, strings.Join(keys, ", "))
+	}
+	if matched.Len() > 0 {
+		b.WriteString("\nLikely sources of the requested fields, best first:\n")
+		b.WriteString(matched.String())
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func describeRule(rule selectors.Rule) string {
+	parts := []string{"selector " + rule.Selector}
+	if rule.AttributeToGet != "" {
+		parts = append(parts, "attributeToGet "+rule.AttributeToGet)
+	}
+	if rule.ExtractMethod != "" {
+		parts = append(parts, "extractMethod "+rule.ExtractMethod)
+	}
+	if rule.JSONPath != "" {
+		parts = append(parts, "jsonPath "+rule.JSONPath)
+	}
+	return strings.Join(parts, ", ")
+}
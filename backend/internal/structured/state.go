@@ -0,0 +1,259 @@
+package structured
+
+import (
+	"fmt"
+	"regexp"
+	"selectorextractor_backend/internal/jsonpath"
+	"selectorextractor_backend/internal/selectors"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// KindState marks values of application state embedded in scripts.
+const KindState = "state"
+
+const (
+	// minStateLeaves skips small JSON blobs such as analytics settings.
+	minStateLeaves = 3
+	// maxStateLeaves bounds the values of one page that are matched against
+	// requested fields.
+	maxStateLeaves = 5000
+	// maxStateDepth bounds how deep the state is followed.
+	maxStateDepth = 12
+	// maxShapeLines and maxShapeKeys bound the shape summary of one state.
+	maxShapeLines = 150
+	maxShapeKeys  = 40
+	// maxShapeValue bounds the sample values in the shape summary.
+	maxShapeValue = 60
+)
+
+var cssIdentifier = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+
+// State is the JSON an application embeds in a script, e.g. Next.js'
+// __NEXT_DATA__ or window.__INITIAL_STATE__ = {...}.
+type State struct {
+	// Selector matches the script; the state is read with extractMethod
+	// "json" and a JSON path into Root.
+	Selector string
+	// Size is the length of the script in bytes.
+	Size int
+	Root any
+}
+
+// FindStates returns the JSON states embedded in the page's scripts and
+// their values as sources for matching. JSON-LD and external scripts are
+// left out.
+func FindStates(doc *goquery.Document) ([]State, []Source) {
+	var states []State
+	doc.Find("script:not([src])").Each(func(_ int, script *goquery.Selection) {
+		scriptType, _ := script.Attr("type")
+		switch strings.ToLower(strings.TrimSpace(scriptType)) {
+		case "", "text/javascript", "application/javascript", "module", "application/json":
+		default:
+			return
+		}
+		root, ok := selectors.ScriptJSON(script.Text())
+		if !ok || countLeaves(root, minStateLeaves) < minStateLeaves {
+			return
+		}
+		states = append(states, State{Selector: scriptSelector(script), Size: len(script.Text()), Root: root})
+	})
+
+	// Rules read the first value found in any script their selector
+	// matches, so values are checked against all of them.
+	roots := make(map[string][]any)
+	for _, state := range states {
+		if _, ok := roots[state.Selector]; ok {
+			continue
+		}
+		doc.Find(state.Selector).Each(func(_ int, script *goquery.Selection) {
+			if root, ok := selectors.ScriptJSON(script.Text()); ok {
+				roots[state.Selector] = append(roots[state.Selector], root)
+			}
+		})
+	}
+
+	var sources []Source
+	for _, state := range states {
+		walkState(state.Root, "$", nil, 0, func(path string, segments []string, value string) bool {
+			if len(sources) >= maxStateLeaves {
+				return false
+			}
+			if len(segments) == 0 || firstInRoots(roots[state.Selector], path) != value {
+				return true
+			}
+			sources = append(sources, Source{
+				Kind:     KindState,
+				Key:      path,
+				Value:    value,
+				Rule:     selectors.Rule{Selector: state.Selector, ExtractMethod: selectors.ExtractMethodJSON, JSONPath: path},
+				segments: segments,
+			})
+			return true
+		})
+	}
+	return states, sources
+}
+
+// scriptSelector returns a selector for a state script: by id if it has one,
+// by type for JSON scripts, otherwise all scripts, as inline assignments are
+// told apart by the variable name at the start of the path.
+func scriptSelector(script *goquery.Selection) string {
+	if id, ok := script.Attr("id"); ok && id != "" {
+		if cssIdentifier.MatchString(id) {
+			return "script#" + id
+		}
+		return "script[id=" + cssString(id) + "]"
+	}
+	if scriptType, _ := script.Attr("type"); strings.EqualFold(strings.TrimSpace(scriptType), "application/json") {
+		return `script[type="application/json"]`
+	}
+	return "script"
+}
+
+func firstInRoots(roots []any, path string) string {
+	compiled, err := jsonpath.Compile(path)
+	if err != nil {
+		return ""
+	}
+	for _, root := range roots {
+		if value := selectors.FirstJSONValue(compiled.Find(root)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// walkState calls emit for the leaves of value until emit returns false.
+// Arrays of objects are followed into their first elements only.
+func walkState(value any, path string, segments []string, depth int, emit func(string, []string, string) bool) bool {
+	if depth > maxStateDepth {
+		return true
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(value) {
+			if !walkState(value[key], path+jsonpath.Member(key), append(segments[:len(segments):len(segments)], key), depth+1, emit) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		if len(value) > 0 && isContainer(value[0]) {
+			for i, element := range value[:min(len(value), maxArrayElements)] {
+				if !walkState(element, fmt.Sprintf("%s[%d]", path, i), segments, depth+1, emit) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if text := selectors.JSONValue(value); text != "" {
+		return emit(path, segments, text)
+	}
+	return true
+}
+
+// countLeaves counts the scalar values of value, stopping at limit.
+func countLeaves(value any, limit int) int {
+	count := 0
+	var walk func(any)
+	walk = func(value any) {
+		switch value := value.(type) {
+		case map[string]any:
+			for _, child := range value {
+				if count >= limit {
+					return
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range value {
+				if count >= limit {
+					return
+				}
+				walk(child)
+			}
+		default:
+			count++
+		}
+	}
+	walk(value)
+	return count
+}
+
+func isContainer(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describeState summarizes the shape of a state for the prompt, one line per
+// path with its JSON type and a sample value. Arrays are described by their
+// first element.
+func describeState(state State) string {
+	var (
+		b     strings.Builder
+		lines int
+	)
+	fmt.Fprintf(&b, "%s (%d KB), extractMethod json:\n", state.Selector, (state.Size+1023)/1024)
+
+	var describe func(value any, path string, depth int)
+	describe = func(value any, path string, depth int) {
+		if lines >= maxShapeLines || depth > maxStateDepth {
+			return
+		}
+		lines++
+		switch value := value.(type) {
+		case map[string]any:
+			fmt.Fprintf(&b, "%s: object\n", path)
+			keys := sortedKeys(value)
+			for _, key := range keys[:min(len(keys), maxShapeKeys)] {
+				describe(value[key], path+jsonpath.Member(key), depth+1)
+			}
+			if len(keys) > maxShapeKeys && lines < maxShapeLines {
+				lines++
+				fmt.Fprintf(&b, "%s: … %d more keys\n", path, len(keys)-maxShapeKeys)
+			}
+		case []any:
+			fmt.Fprintf(&b, "%s: array(%d)\n", path, len(value))
+			if len(value) > 0 {
+				describe(value[0], path+"[0]", depth+1)
+			}
+		case string:
+			fmt.Fprintf(&b, "%s: string = %q\n", path, shorten(value, maxShapeValue))
+		case float64:
+			fmt.Fprintf(&b, "%s: number = %s\n", path, selectors.JSONValue(value))
+		case bool:
+			fmt.Fprintf(&b, "%s: boolean = %t\n", path, value)
+		case nil:
+			fmt.Fprintf(&b, "%s: null\n", path)
+		}
+	}
+	describe(state.Root, "$", 0)
+	if lines >= maxShapeLines {
+		b.WriteString("… shape truncated\n")
+	}
+	return b.String()
+}
+
+func shorten(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit]) + "…"
+}
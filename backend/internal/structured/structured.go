@@ -0,0 +1,319 @@
+// Package structured reads the data pages publish for machines (JSON-LD,
+// microdata, RDFa and OpenGraph meta tags) and turns every value into a rule
+// that reads it back. These sources change far less often than page markup,
+// so requested fields are mapped to them before CSS selectors are considered.
+package structured
+
+import (
+	"fmt"
+	"selectorextractor_backend/internal/jsonpath"
+	"selectorextractor_backend/internal/selectors"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	KindJSONLD    = "jsonld"
+	KindMicrodata = "microdata"
+	KindRDFa      = "rdfa"
+	KindOpenGraph = "opengraph"
+)
+
+// JSONLDSelector matches the script elements holding JSON-LD.
+const JSONLDSelector = `script[type="application/ld+json"]`
+
+const (
+	// maxSources bounds the values read from one page; JSON-LD comes first.
+	maxSources = 200
+	// maxDepth bounds how deep nested JSON-LD objects and microdata items are
+	// followed.
+	maxDepth = 5
+	// maxArrayElements is the number of elements of a JSON-LD array of
+	// objects that are read.
+	maxArrayElements = 3
+)
+
+// kindOrder ranks the kinds by how reliably they describe the page's main
+// entity.
+var kindOrder = map[string]int{KindJSONLD: 0, KindMicrodata: 1, KindRDFa: 2, KindState: 3, KindOpenGraph: 4}
+
+// openGraphPrefixes are the meta tag prefixes of OpenGraph and the Twitter
+// and Facebook variants.
+var openGraphPrefixes = []string{"og:", "article:", "product:", "book:", "profile:", "music:", "video:", "twitter:", "fb:"}
+
+// Source is one value of the page's structured data together with the rule
+// that reads it.
+type Source struct {
+	Kind string
+	// Key names the value, e.g. "Product.offers.price" or "og:title".
+	Key   string
+	Value string
+	Rule  selectors.Rule
+	// segments is Key split into its parts for matching.
+	segments []string
+}
+
+// Find returns the values of the page's structured data: JSON-LD first, then
+// microdata, RDFa and OpenGraph, each in document order. Only values whose
+// rule reads them back from doc are returned.
+func Find(doc *goquery.Document) []Source {
+	var sources []Source
+	sources = append(sources, findJSONLD(doc)...)
+	for _, find := range []func(*goquery.Document) []Source{findMicrodata, findRDFa, findOpenGraph} {
+		for _, source := range find(doc) {
+			if value, err := selectors.Apply(doc, source.Rule); err == nil && value == source.Value {
+				sources = append(sources, source)
+			}
+		}
+	}
+	if len(sources) > maxSources {
+		sources = sources[:maxSources]
+	}
+	return sources
+}
+
+func findJSONLD(doc *goquery.Document) []Source {
+	var blocks []string
+	doc.Find(JSONLDSelector).Each(func(_ int, script *goquery.Selection) {
+		blocks = append(blocks, script.Text())
+	})
+	nodes, _ := selectors.JSONLDNodes(blocks)
+
+	var sources []Source
+	for i, node := range nodes {
+		label, root := jsonLDRoot(nodes, i)
+		walkJSON(node, root, []string{label}, 0, func(path string, segments []string, value string) {
+			// Keep only paths whose first value is this one, as the rule reads
+			// the first match.
+			if compiled, err := jsonpath.Compile(path); err != nil || selectors.FirstJSONValue(compiled.Find(nodes)) != value {
+				return
+			}
+			sources = append(sources, Source{
+				Kind:     KindJSONLD,
+				Key:      strings.Join(segments, "."),
+				Value:    value,
+				Rule:     selectors.Rule{Selector: JSONLDSelector, ExtractMethod: selectors.ExtractMethodJSONLD, JSONPath: path},
+				segments: segments,
+			})
+		})
+	}
+	return sources
+}
+
+// jsonLDRoot returns a label for the i-th node and the path selecting it: by
+// its @type if no other node has the same type, otherwise by position.
+func jsonLDRoot(nodes []any, i int) (string, string) {
+	nodeType := ""
+	if object, ok := nodes[i].(map[string]any); ok {
+		nodeType = selectors.JSONValue(object["@type"])
+	}
+	if nodeType == "" || strings.ContainsAny(nodeType, `'"[]`) {
+		return fmt.Sprintf("node%d", i), fmt.Sprintf("$[%d]", i)
+	}
+	root := fmt.Sprintf("$[?(@['@type']=='%s')]", nodeType)
+	if compiled, err := jsonpath.Compile(root); err != nil || len(compiled.Find(nodes)) != 1 {
+		root = fmt.Sprintf("$[%d]", i)
+	}
+	return nodeType, root
+}
+
+func walkJSON(value any, path string, segments []string, depth int, emit func(string, []string, string)) {
+	if depth > maxDepth {
+		return
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			// @context, @type and @id describe the node, not the page.
+			if !strings.HasPrefix(key, "@") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkJSON(value[key], path+jsonpath.Member(key), append(segments[:len(segments):len(segments)], key), depth+1, emit)
+		}
+	case []any:
+		if len(value) > 0 {
+			if _, ok := value[0].(map[string]any); ok {
+				for i, element := range value[:min(len(value), maxArrayElements)] {
+					walkJSON(element, fmt.Sprintf("%s[%d]", path, i), segments, depth+1, emit)
+				}
+				return
+			}
+		}
+		if text := selectors.JSONValue(value); text != "" {
+			emit(path, segments, text)
+		}
+	default:
+		if text := selectors.JSONValue(value); text != "" {
+			emit(path, segments, text)
+		}
+	}
+}
+
+// findMicrodata reads the properties of top-level itemscope elements and of
+// the items nested in them.
+func findMicrodata(doc *goquery.Document) []Source {
+	var sources []Source
+	doc.Find("[itemscope]").Each(func(_ int, item *goquery.Selection) {
+		if _, nested := item.Attr("itemprop"); nested {
+			return
+		}
+		scope := "[itemscope]"
+		itemType, _ := item.Attr("itemtype")
+		if itemType = strings.TrimSpace(itemType); itemType != "" {
+			scope = "[itemtype=" + cssString(itemType) + "]"
+		}
+		sources = append(sources, microdataProperties(item, scope, []string{typeLabel(itemType)}, 0)...)
+	})
+	return sources
+}
+
+func microdataProperties(item *goquery.Selection, scope string, segments []string, depth int) []Source {
+	if depth > maxDepth {
+		return nil
+	}
+	var sources []Source
+	item.Find("[itemprop]").Each(func(_ int, property *goquery.Selection) {
+		// Properties of nested items belong to those items.
+		if !property.Parent().Closest("[itemscope]").IsSelection(item) {
+			return
+		}
+		names, _ := property.Attr("itemprop")
+		_, isItem := property.Attr("itemscope")
+		for _, name := range strings.Fields(names) {
+			selector := scope + " [itemprop~=" + cssString(name) + "]"
+			path := append(segments[:len(segments):len(segments)], name)
+			if isItem {
+				sources = append(sources, microdataProperties(property, selector, path, depth+1)...)
+				continue
+			}
+			if source, ok := elementSource(KindMicrodata, property, selector, path); ok {
+				sources = append(sources, source)
+			}
+		}
+	})
+	return sources
+}
+
+// findRDFa reads the property attributes of RDFa Lite, scoped by the closest
+// typeof element. OpenGraph meta tags are left to findOpenGraph.
+func findRDFa(doc *goquery.Document) []Source {
+	var sources []Source
+	doc.Find("[property]").Each(func(_ int, property *goquery.Selection) {
+		names, _ := property.Attr("property")
+		if _, isResource := property.Attr("typeof"); isResource || isOpenGraph(names) {
+			return
+		}
+		scope, label := "", "Thing"
+		if typed := property.Parent().Closest("[typeof]"); typed.Length() > 0 {
+			typeOf, _ := typed.Attr("typeof")
+			scope, label = "[typeof="+cssString(typeOf)+"] ", typeLabel(typeOf)
+		}
+		for _, name := range strings.Fields(names) {
+			path := []string{label, typeLabel(name)}
+			if source, ok := elementSource(KindRDFa, property, scope+"[property~="+cssString(name)+"]", path); ok {
+				sources = append(sources, source)
+			}
+		}
+	})
+	return sources
+}
+
+// findOpenGraph reads OpenGraph, Twitter card and Facebook meta tags. Only the
+// first tag of a repeated property is used.
+func findOpenGraph(doc *goquery.Document) []Source {
+	var sources []Source
+	seen := make(map[string]bool)
+	doc.Find("meta[property], meta[name]").Each(func(_ int, meta *goquery.Selection) {
+		attribute := "property"
+		key, _ := meta.Attr(attribute)
+		if !isOpenGraph(key) {
+			attribute = "name"
+			key, _ = meta.Attr(attribute)
+		}
+		content, _ := meta.Attr("content")
+		if !isOpenGraph(key) || seen[key] || strings.TrimSpace(content) == "" {
+			return
+		}
+		seen[key] = true
+		sources = append(sources, Source{
+			Kind:     KindOpenGraph,
+			Key:      key,
+			Value:    strings.TrimSpace(content),
+			Rule:     selectors.Rule{Selector: "meta[" + attribute + "=" + cssString(key) + "]", AttributeToGet: "content"},
+			segments: strings.Split(key, ":"),
+		})
+	})
+	return sources
+}
+
+func isOpenGraph(key string) bool {
+	for _, prefix := range openGraphPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// elementSource reads a microdata or RDFa property value: the content
+// attribute if present, otherwise the attribute HTML defines for the element
+// (href, src, datetime, ...) or its text.
+func elementSource(kind string, element *goquery.Selection, selector string, segments []string) (Source, bool) {
+	rule := selectors.Rule{Selector: selector}
+	if _, ok := element.Attr("content"); ok {
+		rule.AttributeToGet = "content"
+	} else {
+		switch goquery.NodeName(element) {
+		case "a", "area", "link":
+			rule.AttributeToGet = "href"
+		case "img", "audio", "video", "source", "embed", "iframe", "track":
+			rule.AttributeToGet = "src"
+		case "object":
+			rule.AttributeToGet = "data"
+		case "time":
+			if _, ok := element.Attr("datetime"); ok {
+				rule.AttributeToGet = "datetime"
+			}
+		case "data", "meter":
+			rule.AttributeToGet = "value"
+		}
+	}
+
+	var value string
+	if rule.AttributeToGet != "" {
+		value, _ = element.Attr(rule.AttributeToGet)
+	} else {
+		rule.ExtractMethod = "innerText"
+		value = strings.Join(strings.Fields(element.Text()), " ")
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Source{}, false
+	}
+	return Source{Kind: kind, Key: strings.Join(segments, "."), Value: value, Rule: rule, segments: segments}, true
+}
+
+// typeLabel returns the last part of a type or property IRI, e.g. "Product"
+// for "https://schema.org/Product" or "price" for "schema:price".
+func typeLabel(iri string) string {
+	fields := strings.Fields(iri)
+	if len(fields) == 0 {
+		return "Thing"
+	}
+	label := fields[0]
+	if i := strings.LastIndexAny(label, "/#:"); i >= 0 && i < len(label)-1 {
+		label = label[i+1:]
+	}
+	return label
+}
+
+// cssString quotes s for use in an attribute selector.
+func cssString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,207 @@
+package structured
+
+import (
+	"selectorextractor_backend/internal/selectors"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const testPage = `<html><head>
+<meta property="og:title" content="Trail Runner 2 | Northpeak">
+<meta property="og:image" content="https://cdn.example.com/og.jpg">
+<meta name="twitter:card" content="summary">
+<script type="application/ld+json">[
+ {"@context": "https://schema.org", "@type": "Organization", "name": "Northpeak", "url": "https://northpeak.example"},
+ {"@context": "https://schema.org", "@type": "Product", "name": "Trail Runner 2", "sku": "TR2",
+  "brand": {"@type": "Brand", "name": "Northpeak"},
+  "offers": {"@type": "Offer", "price": "129.99", "priceCurrency": "EUR"}}
+]</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product">
+  <span itemprop="name">Trail Runner 2</span>
+  <div itemprop="aggregateRating" itemscope itemtype="https://schema.org/AggregateRating">
+    <span itemprop="ratingValue">4.5</span>
+    <span itemprop="reviewCount">120</span>
+  </div>
+  <a itemprop="url" href="/p/tr2">details</a>
+</div>
+<div vocab="https://schema.org/" typeof="Person"><span property="name">Jane Doe</span></div>
+<script id="__NEXT_DATA__" type="application/json">{"props": {"pageProps": {"product": {"title": "Trail Runner 2", "stock": 7, "variants": [{"size": "42"}, {"size": "43"}]}}}}</script>
+<script>var analytics = {"id": 1};</script>
+</body></html>`
+
+func parseTestPage(t *testing.T) *goquery.Document {
+	t.Helper()
+	doc, err := selectors.Parse(testPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestFind(t *testing.T) {
+	doc := parseTestPage(t)
+	sources := Find(doc)
+	found := make(map[string]Source, len(sources))
+	for i, source := range sources {
+		found[source.Kind+" "+source.Key] = source
+		if i > 0 && kindOrder[source.Kind] < kindOrder[sources[i-1].Kind] {
+			t.Errorf("%s %s comes after %s", source.Kind, source.Key, sources[i-1].Kind)
+		}
+		// Every source is read back by its rule.
+		if value, err := selectors.Apply(doc, source.Rule); err != nil || value != source.Value {
+			t.Errorf("rule of %s %s reads %q, %v, want %q", source.Kind, source.Key, value, err, source.Value)
+		}
+	}
+
+	tests := []struct {
+		source string
+		value  string
+		rule   selectors.Rule
+	}{
+		{"jsonld Product.name", "Trail Runner 2", selectors.Rule{Selector: JSONLDSelector, ExtractMethod: "jsonld", JSONPath: "$[?(@['@type']=='Product')].name"}},
+		{"jsonld Product.offers.price", "129.99", selectors.Rule{Selector: JSONLDSelector, ExtractMethod: "jsonld", JSONPath: "$[?(@['@type']=='Product')].offers.price"}},
+		{"jsonld Product.brand.name", "Northpeak", selectors.Rule{Selector: JSONLDSelector, ExtractMethod: "jsonld", JSONPath: "$[?(@['@type']=='Product')].brand.name"}},
+		{"jsonld Organization.url", "https://northpeak.example", selectors.Rule{Selector: JSONLDSelector, ExtractMethod: "jsonld", JSONPath: "$[?(@['@type']=='Organization')].url"}},
+		{"microdata Product.name", "Trail Runner 2", selectors.Rule{Selector: `[itemtype="https://schema.org/Product"] [itemprop~="name"]`, ExtractMethod: "innerText"}},
+		{"microdata Product.aggregateRating.ratingValue", "4.5", selectors.Rule{Selector: `[itemtype="https://schema.org/Product"] [itemprop~="aggregateRating"] [itemprop~="ratingValue"]`, ExtractMethod: "innerText"}},
+		{"microdata Product.url", "/p/tr2", selectors.Rule{Selector: `[itemtype="https://schema.org/Product"] [itemprop~="url"]`, AttributeToGet: "href"}},
+		{"rdfa Person.name", "Jane Doe", selectors.Rule{Selector: `[typeof="Person"] [property~="name"]`, ExtractMethod: "innerText"}},
+		{"opengraph og:title", "Trail Runner 2 | Northpeak", selectors.Rule{Selector: `meta[property="og:title"]`, AttributeToGet: "content"}},
+		{"opengraph twitter:card", "summary", selectors.Rule{Selector: `meta[name="twitter:card"]`, AttributeToGet: "content"}},
+	}
+	for _, test := range tests {
+		source, ok := found[test.source]
+		if !ok {
+			t.Errorf("%s not found", test.source)
+			continue
+		}
+		if source.Value != test.value || source.Rule != test.rule {
+			t.Errorf("%s = %q with %+v, want %q with %+v", test.source, source.Value, source.Rule, test.value, test.rule)
+		}
+	}
+	for _, key := range []string{"jsonld Organization.@type", "jsonld Product.@context"} {
+		if _, ok := found[key]; ok {
+			t.Errorf("%s found, want @ keys left out", key)
+		}
+	}
+}
+
+func TestFindStates(t *testing.T) {
+	states, sources := FindStates(parseTestPage(t))
+	if len(states) != 1 || states[0].Selector != "script#__NEXT_DATA__" {
+		t.Fatalf("states = %+v, want only __NEXT_DATA__", states)
+	}
+
+	got := make(map[string]string, len(sources))
+	for _, source := range sources {
+		got[source.Key] = source.Value
+		if source.Kind != KindState || source.Rule.ExtractMethod != selectors.ExtractMethodJSON || source.Rule.JSONPath != source.Key {
+			t.Errorf("source %s has rule %+v", source.Key, source.Rule)
+		}
+	}
+	want := map[string]string{
+		"$.props.pageProps.product.title":            "Trail Runner 2",
+		"$.props.pageProps.product.stock":            "7",
+		"$.props.pageProps.product.variants[0].size": "42",
+		"$.props.pageProps.product.variants[1].size": "43",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("state value %s = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := parseTestPage(t)
+	_, states := FindStates(doc)
+	sources := append(Find(doc), states...)
+
+	tests := []struct {
+		field Field
+		want  []string
+	}{
+		// An exact key ranks before a synonym, then JSON-LD before other kinds.
+		{Field{"title", "text"}, []string{"state $.props.pageProps.product.title", "opengraph og:title", "jsonld Product.name"}},
+		{Field{"productTitle", "text"}, []string{"state $.props.pageProps.product.title", "opengraph og:title", "jsonld Product.name"}},
+		// The page's own entities rank before site-wide ones.
+		{Field{"name", "text"}, []string{"jsonld Product.name", "jsonld Product.brand.name", "jsonld Organization.name"}},
+		{Field{"price", "number"}, []string{"jsonld Product.offers.price"}},
+		// brand.name names the brand.
+		{Field{"brand", "text"}, []string{"jsonld Product.brand.name"}},
+		{Field{"rating", "number"}, []string{"microdata Product.aggregateRating.ratingValue"}},
+		{Field{"reviews", "number"}, []string{"microdata Product.aggregateRating.reviewCount"}},
+		{Field{"image", "image"}, []string{"opengraph og:image"}},
+		// Values must fit the field type.
+		{Field{"price", "date"}, nil},
+		{Field{"color", "text"}, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, match := range Match(sources, test.field) {
+			got = append(got, match.Kind+" "+match.Key)
+		}
+		if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+			t.Errorf("Match(%s) = %v, want %v", test.field.Name, got, test.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	doc := parseTestPage(t)
+	states, stateSources := FindStates(doc)
+	description := Describe(append(Find(doc), stateSources...), states, []Field{{"price", "number"}})
+	for _, want := range []string{
+		`- jsonld Product.offers.price = "129.99"; selector script[type="application/ld+json"], extractMethod jsonld, jsonPath $[?(@['@type']=='Product')].offers.price`,
+		"Embedded state in script#__NEXT_DATA__ (1 KB), extractMethod json:",
+		`$.props.pageProps.product.title: string = "Trail Runner 2"`,
+		"- price: jsonld Product.offers.price",
+	} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description lacks %q:\n%s", want, description)
+		}
+	}
+	if Describe(nil, nil, []Field{{"price", "number"}}) != "" {
+		t.Error("description of a page without structured data is not empty")
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"productTitle", "product title"},
+		{"price_amount", "price amount"},
+		{"og:image", "og image"},
+		{"SKU", "sku"},
+		{"ratingValue2", "rating value2"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := strings.Join(splitWords(test.name), " "); got != test.want {
+			t.Errorf("splitWords(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTypeLabel(t *testing.T) {
+	tests := []struct {
+		iri  string
+		want string
+	}{
+		{"https://schema.org/Product", "Product"},
+		{"schema:price", "price"},
+		{"http://example.com/ns#Offer", "Offer"},
+		{"Product Thing", "Product"},
+		{"", "Thing"},
+	}
+	for _, test := range tests {
+		if got := typeLabel(test.iri); got != test.want {
+			t.Errorf("typeLabel(%q) = %q, want %q", test.iri, got, test.want)
+		}
+	}
+}
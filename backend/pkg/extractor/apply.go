@@ -0,0 +1,135 @@
+package extractor
+
+import (
+	"context"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/selectors"
+	"selectorextractor_backend/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ApplyField is a saved selector together with the type of its field, which
+// decides how the extracted value is converted. Type defaults to the type
+// saved with the selector.
+type ApplyField struct {
+	Selector
+	Type string `json:"type,omitempty"`
+}
+
+// ApplyRequest holds a document and the saved selectors to run against it.
+type ApplyRequest struct {
+	HTML string `json:"html"`
+	// URL is fetched when HTML is empty. It is the default BaseURL.
+	URL   string        `json:"url,omitempty"`
+	Fetch *FetchOptions `json:"fetch,omitempty"`
+	// BaseURL is the address of the document. Relative link and image values
+	// are resolved against it, or against the document's <base> element.
+	BaseURL string       `json:"baseUrl,omitempty"`
+	Fields  []ApplyField `json:"fields"`
+}
+
+// Value is the result of applying one selector to a document. Value holds the
+// typed value: a float64 for number fields, an absolute URL for link and image
+// fields if a base URL is known, an ISO 8601 string for date and datetime
+// fields, an amount and currency for price fields, a bool for boolean fields,
+// the matched allowed value for enum fields, otherwise the extracted text. Raw
+// is the text before conversion. For multi-valued fields Value is a list of
+// typed values and Raws holds their texts. For object and array fields Value
+// is the record, a map of child values or a list of such maps, and Error lists
+// the child fields that could not be read.
+type Value struct {
+	Field string   `json:"field"`
+	Type  string   `json:"type,omitempty"`
+	Value any      `json:"value"`
+	Raw   string   `json:"raw"`
+	Raws  []string `json:"raws,omitempty"`
+	// Fallback is the number of the fallback rule that produced Value, 0 for
+	// the field's own rule.
+	Fallback int    `json:"fallback,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Apply runs saved selectors against html and returns their values as text.
+// It is ApplyFields without field types or base URL.
+func (e *Extractor) Apply(ctx context.Context, html string, fields []Selector) ([]Value, error) {
+	request := ApplyRequest{HTML: html, Fields: make([]ApplyField, 0, len(fields))}
+	for _, field := range fields {
+		request.Fields = append(request.Fields, ApplyField{Selector: field})
+	}
+	return e.ApplyFields(ctx, request)
+}
+
+// ApplyFields runs the request's selectors against its HTML, fetching it
+// first if only a URL is given, and returns one Value per field. Selector and
+// conversion failures are reported per field; only a failed fetch or an
+// unparseable document or base URL fails the whole call.
+func (e *Extractor) ApplyFields(ctx context.Context, request ApplyRequest) ([]Value, error) {
+	ctx, span := tracing.Start(ctx, "ApplyFields", attribute.Int("fields.count", len(request.Fields)))
+	defer span.End()
+
+	if request.HTML == "" && request.URL != "" {
+		loaded, err := e.Load(ctx, Request{URL: request.URL, Fetch: request.Fetch})
+		if err != nil {
+			tracing.RecordError(span, err)
+			return nil, err
+		}
+		request.HTML = loaded.HTML
+		request.URL = loaded.URL
+	}
+	if request.BaseURL == "" {
+		request.BaseURL = request.URL
+	}
+
+	doc, err := selectors.Parse(request.HTML)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	base, err := selectors.BaseURL(doc, request.BaseURL)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	values := make([]Value, 0, len(request.Fields))
+	failed := 0
+	for _, field := range request.Fields {
+		if field.Type == "" {
+			field.Type = field.Selector.Type
+		}
+		field.Selector.Type = field.Type
+		value := Value{Field: field.Field, Type: field.Type}
+		switch {
+		case field.Selector.Selector == "" && field.JavaScriptFunction != "":
+			value.Error = "function-only fields cannot be applied"
+		case field.Selector.Selector == "":
+			value.Error = selectors.ErrNoSelector.Error()
+		case ai.IsRecord(field.Type):
+			var issues []ai.Issue
+			value.Value, issues = ai.Evaluate(doc.Selection, field.Selector, base)
+			if err := ai.IssuesError(issues); err != nil {
+				value.Error = err.Error()
+			}
+		default:
+			reading, err := ai.Read(doc.Selection, field.Selector, base)
+			if field.Multiple {
+				value.Raws = reading.Raws
+			} else if len(reading.Raws) > 0 {
+				value.Raw = reading.Raws[0]
+			}
+			if err != nil {
+				value.Error = err.Error()
+			} else {
+				value.Value = reading.Value
+				value.Fallback = reading.Fallback
+			}
+		}
+		if value.Error != "" {
+			failed++
+		}
+		values = append(values, value)
+	}
+	span.SetAttributes(attribute.Int("fields.failed", failed))
+	return values, nil
+}
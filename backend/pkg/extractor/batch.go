@@ -0,0 +1,207 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"selectorextractor_backend/internal/ai"
+)
+
+// BatchRounds is the number of extractions ExtractBatch makes at most, each of
+// up to ai.MAX_TRIES model calls.
+const BatchRounds = 3
+
+// Document is one HTML page of a batch.
+type Document struct {
+	Name    string `json:"name"`
+	HTML    string `json:"html"`
+	BaseURL string `json:"baseUrl,omitempty"`
+}
+
+// BatchApplyRequest applies one set of saved selectors to many documents.
+type BatchApplyRequest struct {
+	Documents []Document   `json:"documents"`
+	Fields    []ApplyField `json:"fields"`
+}
+
+// BatchRow holds the values extracted from one document. Success is false if
+// the document could not be read or any field failed.
+type BatchRow struct {
+	Document string  `json:"document"`
+	Success  bool    `json:"success"`
+	Error    string  `json:"error,omitempty"`
+	Values   []Value `json:"values"`
+}
+
+// ApplyBatch applies the request's selectors to each document. Failures are
+// reported per document and field.
+func (e *Extractor) ApplyBatch(ctx context.Context, request BatchApplyRequest) []BatchRow {
+	rows := make([]BatchRow, 0, len(request.Documents))
+	for _, document := range request.Documents {
+		row := BatchRow{Document: document.Name}
+		values, err := e.ApplyFields(ctx, ApplyRequest{
+			HTML:    document.HTML,
+			BaseURL: document.BaseURL,
+			Fields:  request.Fields,
+		})
+		if err != nil {
+			row.Error = err.Error()
+		} else {
+			row.Values = values
+			row.Success = true
+			for _, value := range values {
+				if value.Error != "" {
+					row.Success = false
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// BatchExtractRequest asks for one selector set that works on all documents.
+type BatchExtractRequest struct {
+	Documents                   []Document `json:"documents"`
+	FieldsToExtractSelectorsFor []Field    `json:"fieldsToExtractSelectorsFor"`
+	Model                       string     `json:"model"`
+	PromptVersion               string     `json:"promptVersion,omitempty"`
+}
+
+// FieldCoverage is the number of documents a field's selector passes
+// validation on.
+type FieldCoverage struct {
+	Field     string `json:"field"`
+	Passed    int    `json:"passed"`
+	Documents int    `json:"documents"`
+}
+
+// BatchExtractResult is the selector set chosen by ExtractBatch, the summed
+// usage and price of all rounds, the per-field coverage and the values the
+// selectors yield on every document.
+type BatchExtractResult struct {
+	Result
+	Rounds   int             `json:"rounds"`
+	Coverage []FieldCoverage `json:"coverage"`
+	Rows     []BatchRow      `json:"rows"`
+}
+
+// ExtractBatch generates selectors from the first document and validates
+// them against all documents. Fields that fail on some document are
+// generated again from the first such document, and the new rule and its
+// fallbacks are added to the old selector's fallbacks if that passes on more
+// documents, for up to BatchRounds rounds. Function-only and record fields
+// are replaced instead.
+func (e *Extractor) ExtractBatch(ctx context.Context, request BatchExtractRequest) (BatchExtractResult, error) {
+	result := BatchExtractResult{Result: Result{Model: request.Model}}
+	if len(request.Documents) == 0 {
+		return result, errors.New("no documents given")
+	}
+
+	chosen := make(map[string]Selector)
+	passed := make(map[string]int)
+	pending := request.FieldsToExtractSelectorsFor
+	sample := request.Documents[0]
+	for len(pending) > 0 && result.Rounds < BatchRounds {
+		response, err := e.Extract(ctx, Request{
+			HTML:                        sample.HTML,
+			BaseURL:                     sample.BaseURL,
+			FieldsToExtractSelectorsFor: pending,
+			Model:                       request.Model,
+			PromptVersion:               request.PromptVersion,
+		})
+		result.Rounds++
+		result.addUsage(response)
+		if err != nil {
+			if len(chosen) == 0 {
+				return result, err
+			}
+			break
+		}
+
+		candidates := make([]Selector, 0, len(response.Fields))
+		for _, field := range response.Fields {
+			// A rule generated from a document the chosen rule fails on is
+			// tried after it as a fallback.
+			if current, ok := chosen[field.Field]; ok && current.Selector != "" && field.Selector != "" && !ai.IsRecord(field.Type) {
+				field = current.WithFallbacks(field)
+			}
+			candidates = append(candidates, field)
+		}
+		covered := e.coverage(request.Documents, pending, candidates)
+		for _, field := range candidates {
+			if _, ok := chosen[field.Field]; !ok || covered[field.Field] > passed[field.Field] {
+				chosen[field.Field] = field
+				passed[field.Field] = covered[field.Field]
+			}
+		}
+
+		pending, sample = e.failing(request.Documents, request.FieldsToExtractSelectorsFor, chosen)
+	}
+
+	applyFields := make([]ApplyField, 0, len(request.FieldsToExtractSelectorsFor))
+	for _, want := range request.FieldsToExtractSelectorsFor {
+		field, ok := chosen[want.Name]
+		if !ok {
+			continue
+		}
+		result.Fields = append(result.Fields, field)
+		result.Coverage = append(result.Coverage, FieldCoverage{
+			Field:     want.Name,
+			Passed:    passed[want.Name],
+			Documents: len(request.Documents),
+		})
+		applyFields = append(applyFields, ApplyField{Selector: field, Type: want.Type})
+	}
+	result.Rows = e.ApplyBatch(ctx, BatchApplyRequest{Documents: request.Documents, Fields: applyFields})
+	return result, nil
+}
+
+func (r *BatchExtractResult) addUsage(response Result) {
+	r.Usage.InputTokens += response.Usage.InputTokens
+	r.Usage.OutputTokens += response.Usage.OutputTokens
+	r.PriceInputTokens += response.PriceInputTokens
+	r.PriceOutputTokens += response.PriceOutputTokens
+	r.TotalPrice += response.TotalPrice
+	if response.PromptVersion != "" {
+		r.PromptVersion = response.PromptVersion
+	}
+}
+
+// coverage returns the number of documents each selector passes validation
+// on.
+func (e *Extractor) coverage(documents []Document, requested []Field, fields []Selector) map[string]int {
+	passed := make(map[string]int)
+	for _, document := range documents {
+		for _, validation := range e.validator(document.HTML, document.BaseURL, requested, fields) {
+			if validation.Valid {
+				passed[validation.Field]++
+			}
+		}
+	}
+	return passed
+}
+
+// failing returns the requested fields whose chosen selector fails on the
+// first document with any failure, together with that document.
+func (e *Extractor) failing(documents []Document, requested []Field, chosen map[string]Selector) ([]Field, Document) {
+	fields := make([]Selector, 0, len(chosen))
+	for _, field := range chosen {
+		fields = append(fields, field)
+	}
+	byName := make(map[string]Field, len(requested))
+	for _, want := range requested {
+		byName[want.Name] = want
+	}
+	for _, document := range documents {
+		var failed []Field
+		for _, validation := range e.validator(document.HTML, document.BaseURL, requested, fields) {
+			if want, ok := byName[validation.Field]; ok && !validation.Valid {
+				failed = append(failed, want)
+			}
+		}
+		if len(failed) > 0 {
+			return failed, document
+		}
+	}
+	return nil, Document{}
+}
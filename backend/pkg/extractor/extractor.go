@@ -0,0 +1,352 @@
+// Package extractor generates CSS selectors for fields of an HTML page with a
+// language model and applies saved selectors to new documents. It is the
+// library behind the HTTP server and the CLI and can be embedded in other Go
+// programs.
+//
+//	ext, err := extractor.New(extractor.WithAPIKey(os.Getenv("OPENROUTER_API_KEY")))
+//	result, err := ext.Extract(ctx, extractor.Request{
+//		HTML:                        html,
+//		FieldsToExtractSelectorsFor: []extractor.Field{{Name: "price", Type: "number"}},
+//		Model:                       "google/gemini-2.5-flash",
+//	})
+//	values, err := ext.Apply(ctx, otherHTML, result.Fields)
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/internal/config"
+	"selectorextractor_backend/internal/fetch"
+	"selectorextractor_backend/internal/helpers"
+	"selectorextractor_backend/internal/selectors"
+	"selectorextractor_backend/internal/structured"
+	"selectorextractor_backend/internal/tracing"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type (
+	Request         = ai.SendExtractionMessageRequest
+	Result          = ai.SendExtractionMessageResponse
+	Field           = ai.FieldToExtractSelectorsFor
+	Selector        = ai.ExtractedSelector
+	Estimate        = ai.UsageEstimate
+	FieldValidation = ai.FieldValidation
+	ModelPrice      = ai.ModelPrice
+	Provider        = ai.Provider
+	KeySource       = ai.KeySource
+	Validator       = ai.Validator
+	Config          = config.AIConfig
+	FetchConfig     = config.FetchConfig
+	FetchOptions    = fetch.Options
+)
+
+// Cleaner reduces HTML before it is sent to the model.
+type Cleaner func(html string) string
+
+var (
+	ErrNoAPIKey         = errors.New("provider requires an API key")
+	ErrUnsupportedModel = errors.New("unsupported model")
+)
+
+// Extractor runs extractions with a fixed provider, model registry, cleaner
+// and validator. It is safe for concurrent use.
+type Extractor struct {
+	provider  Provider
+	keys      KeySource
+	models    map[string]ModelPrice
+	cleaner   Cleaner
+	validator Validator
+	config    Config
+	fetcher   *fetch.Fetcher
+}
+
+// defaultFetchConfig matches the server defaults of the FETCH_* variables.
+var defaultFetchConfig = FetchConfig{
+	Timeout:       15 * time.Second,
+	MaxBytes:      5 << 20,
+	MaxRedirects:  5,
+	UserAgent:     "selectorextractor/1.0 (+https://github.com/sstehniy/selectorextractor)",
+	RespectRobots: true,
+}
+
+type Option func(*Extractor) error
+
+// WithProvider sets the model provider. The default is OpenRouter.
+func WithProvider(provider Provider) Option {
+	return func(e *Extractor) error {
+		e.provider = provider
+		return nil
+	}
+}
+
+// WithKeys sets the source of provider API keys.
+func WithKeys(keys KeySource) Option {
+	return func(e *Extractor) error {
+		e.keys = keys
+		return nil
+	}
+}
+
+// WithAPIKey uses a single provider API key for all requests.
+func WithAPIKey(key string) Option {
+	return WithKeys(ai.StaticKey(key))
+}
+
+// WithModels replaces the registry of models requests may use and their
+// prices in USD per million tokens.
+func WithModels(models map[string]ModelPrice) Option {
+	return func(e *Extractor) error {
+		if len(models) == 0 {
+			return errors.New("model registry is empty")
+		}
+		e.models = models
+		return nil
+	}
+}
+
+// WithCleaner sets the function that reduces HTML before extraction.
+func WithCleaner(cleaner Cleaner) Option {
+	return func(e *Extractor) error {
+		e.cleaner = cleaner
+		return nil
+	}
+}
+
+// WithCleanerProfile selects one of the built-in cleaners: "default",
+// "minimal" or "none".
+func WithCleanerProfile(profile string) Option {
+	return func(e *Extractor) error {
+		cleaner, ok := helpers.CleanerForProfile(profile)
+		if !ok {
+			return fmt.Errorf("unknown cleaner profile %q", profile)
+		}
+		e.cleaner = cleaner
+		return nil
+	}
+}
+
+// WithValidator sets the function that checks returned selectors against the
+// sample HTML.
+func WithValidator(validator Validator) Option {
+	return func(e *Extractor) error {
+		e.validator = validator
+		return nil
+	}
+}
+
+// WithConfig sets the model parameters (max tokens, temperature, prompt
+// version) and the cleaner profile from cfg.
+func WithConfig(cfg Config) Option {
+	return func(e *Extractor) error {
+		e.config = cfg
+		if cfg.CleanerProfile != "" {
+			return WithCleanerProfile(cfg.CleanerProfile)(e)
+		}
+		return nil
+	}
+}
+
+// WithFetchConfig sets the limits, headers and robots.txt handling for
+// requests that give a URL instead of HTML.
+func WithFetchConfig(cfg FetchConfig) Option {
+	return func(e *Extractor) error {
+		e.fetcher = fetch.New(cfg)
+		return nil
+	}
+}
+
+// WithPromptVersion sets the prompt version used for requests that do not
+// specify one.
+func WithPromptVersion(version string) Option {
+	return func(e *Extractor) error {
+		if !ai.IsPromptVersion(version) {
+			return fmt.Errorf("unknown prompt version %q", version)
+		}
+		e.config.PromptVersion = version
+		return nil
+	}
+}
+
+// New creates an Extractor. Without options it uses OpenRouter, the built-in
+// models, the default cleaner and validator, and reads no API key.
+func New(opts ...Option) (*Extractor, error) {
+	e := &Extractor{
+		provider:  ai.OpenRouterProvider{},
+		models:    ai.MODEL_PRICE_MAP,
+		cleaner:   helpers.PrepareHtmlForExtraction,
+		validator: ai.ValidateFields,
+		config: Config{
+			MaxTokens:   8192,
+			Temperature: 0.4,
+		},
+		fetcher: fetch.New(defaultFetchConfig),
+	}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// UsingKeys returns a copy of the Extractor that takes provider API keys from
+// keys, e.g. a key supplied with a single request.
+func (e *Extractor) UsingKeys(keys KeySource) *Extractor {
+	copied := *e
+	copied.keys = keys
+	return &copied
+}
+
+// RequiresAPIKey reports whether the provider needs an API key.
+func (e *Extractor) RequiresAPIKey() bool {
+	return e.provider.RequiresAPIKey()
+}
+
+// SupportsModel reports whether model is in the registry.
+func (e *Extractor) SupportsModel(model string) bool {
+	_, ok := e.models[model]
+	return ok
+}
+
+// Models returns the registered model ids in alphabetical order.
+func (e *Extractor) Models() []string {
+	models := make([]string, 0, len(e.models))
+	for model := range e.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Clean applies the configured cleaner to html.
+func (e *Extractor) Clean(ctx context.Context, html string) string {
+	_, span := tracing.Start(ctx, "PrepareHtmlForExtraction", attribute.Int("html.size", len(html)))
+	defer span.End()
+	cleaned := e.cleaner(html)
+	span.SetAttributes(attribute.Int("html.cleaned_size", len(cleaned)))
+	return cleaned
+}
+
+// Load fetches the request's URL if it has no HTML and sets URL to the
+// address after redirects. Requests with HTML are returned unchanged.
+func (e *Extractor) Load(ctx context.Context, request Request) (Request, error) {
+	if request.HTML != "" || request.URL == "" {
+		return request, nil
+	}
+	var opts FetchOptions
+	if request.Fetch != nil {
+		opts = *request.Fetch
+	}
+	page, err := e.fetcher.Fetch(ctx, request.URL, opts)
+	if err != nil {
+		return request, &FetchError{URL: request.URL, Err: err}
+	}
+	request.HTML = page.HTML
+	request.URL = page.URL
+	return request, nil
+}
+
+// FetchError is returned when the URL of a request cannot be fetched.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Extract cleans the request's HTML, fetching it first if only a URL is
+// given, and asks the model for selectors for the requested fields. The
+// returned Result carries the usage and price even if the extraction fails.
+func (e *Extractor) Extract(ctx context.Context, request Request) (Result, error) {
+	if err := e.check(request); err != nil {
+		return Result{Model: request.Model}, err
+	}
+	request, err := e.Load(ctx, request)
+	if err != nil {
+		return Result{Model: request.Model}, err
+	}
+	request = e.prepare(ctx, request)
+	result, err := ai.SendExtractionMessageOpenAI(ctx, request, e.options())
+	result.URL = request.URL
+	return result, err
+}
+
+// Estimate returns the estimated tokens and price of Extract for request
+// without calling the model.
+func (e *Extractor) Estimate(ctx context.Context, request Request) (Estimate, error) {
+	if !e.SupportsModel(request.Model) {
+		return Estimate{}, fmt.Errorf("%w: %s", ErrUnsupportedModel, request.Model)
+	}
+	request, err := e.Load(ctx, request)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return ai.EstimateUsage(e.prepare(ctx, request), e.options())
+}
+
+// prepare describes the structured data of the request's HTML for the prompt
+// and cleans it. The original HTML is kept for validating the returned
+// selectors.
+func (e *Extractor) prepare(ctx context.Context, request Request) Request {
+	request.SourceHTML = request.HTML
+	request.StructuredData = e.StructuredData(ctx, request.HTML, request.FieldsToExtractSelectorsFor)
+	request.HTML = e.Clean(ctx, request.HTML)
+	return request
+}
+
+// StructuredData describes the JSON-LD, microdata, RDFa and OpenGraph values
+// and the embedded application state of html, and the values likely to hold
+// the requested fields, as sent to the model. It returns "" for pages without
+// structured data.
+func (e *Extractor) StructuredData(ctx context.Context, html string, fields []Field) string {
+	_, span := tracing.Start(ctx, "structured.Find")
+	defer span.End()
+
+	doc, err := selectors.Parse(html)
+	if err != nil {
+		return ""
+	}
+	sources := structured.Find(doc)
+	states, stateSources := structured.FindStates(doc)
+	span.SetAttributes(
+		attribute.Int("sources.count", len(sources)),
+		attribute.Int("states.count", len(states)),
+	)
+
+	requested := make([]structured.Field, 0, len(fields))
+	for _, field := range fields {
+		requested = append(requested, structured.Field{Name: field.Name, Type: field.Type})
+	}
+	return structured.Describe(append(sources, stateSources...), states, requested)
+}
+
+func (e *Extractor) check(request Request) error {
+	if !e.SupportsModel(request.Model) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedModel, request.Model)
+	}
+	if e.provider.RequiresAPIKey() && e.keys == nil {
+		return ErrNoAPIKey
+	}
+	return nil
+}
+
+func (e *Extractor) options() ai.Options {
+	return ai.Options{
+		Provider:  e.provider,
+		Keys:      e.keys,
+		Models:    e.models,
+		Validator: e.validator,
+		Config:    e.config,
+	}
+}
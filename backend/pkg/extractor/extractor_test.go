@@ -0,0 +1,86 @@
+package extractor_test
+
+import (
+	"context"
+	"testing"
+
+	"selectorextractor_backend/internal/ai"
+	"selectorextractor_backend/pkg/extractor"
+
+	"github.com/revrost/go-openrouter"
+)
+
+var titleAnswer = ai.Answer(ai.ExtractedSelector{Field: "title", Selector: "h1", ExtractMethod: "textContent"})
+
+func titleRequest() extractor.Request {
+	return extractor.Request{
+		HTML:                        "<html><body><h1>Title</h1></body></html>",
+		FieldsToExtractSelectorsFor: []extractor.Field{{Name: "title", Type: "text"}},
+		Model:                       "x-ai/grok-3-mini",
+	}
+}
+
+func TestExtractFailedAttemptWithoutKeys(t *testing.T) {
+	provider := ai.NewScriptedProvider(ai.ScriptStep{Error: "upstream unavailable"})
+	ext, err := extractor.New(extractor.WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ext.Extract(context.Background(), titleRequest())
+	if err == nil {
+		t.Fatal("Extract succeeded, want the provider's error")
+	}
+}
+
+func TestExtractCountsUsageOfFailedAttempts(t *testing.T) {
+	provider := ai.NewScriptedProvider(
+		ai.ScriptStep{Content: "not JSON", Usage: openrouter.Usage{PromptTokens: 100, CompletionTokens: 10}},
+		ai.ScriptStep{Content: titleAnswer.Content, Usage: openrouter.Usage{PromptTokens: 200, CompletionTokens: 20}},
+	)
+	ext, err := extractor.New(extractor.WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ext.Extract(context.Background(), titleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Usage.InputTokens != 300 || result.Usage.OutputTokens != 30 {
+		t.Errorf("usage = %+v, want the sum of both attempts", result.Usage)
+	}
+	if result.TotalPrice == 0 {
+		t.Error("total price = 0, want the price of both attempts")
+	}
+}
+
+func TestExtractBatchPassesBaseURL(t *testing.T) {
+	// The first validation is the sample's, the others check the rules on
+	// every document.
+	var urls []string
+	validator := func(html, url string, requested []ai.FieldToExtractSelectorsFor, fields []ai.ExtractedSelector) []ai.FieldValidation {
+		urls = append(urls, url)
+		return ai.ValidateFields(html, url, requested, fields)
+	}
+	ext, err := extractor.New(
+		extractor.WithProvider(ai.NewScriptedProvider(titleAnswer)),
+		extractor.WithValidator(validator),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := titleRequest()
+	_, err = ext.ExtractBatch(context.Background(), extractor.BatchExtractRequest{
+		Documents:                   []extractor.Document{{Name: "p1", HTML: request.HTML, BaseURL: "https://shop.example/p/1"}},
+		FieldsToExtractSelectorsFor: request.FieldsToExtractSelectorsFor,
+		Model:                       request.Model,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) == 0 || urls[0] != "https://shop.example/p/1" {
+		t.Errorf("validated with URLs %q, want the sample's base URL first", urls)
+	}
+}
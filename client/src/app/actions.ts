@@ -28,7 +28,6 @@ export const extract = async (
   },
   apiKey: string,
 ): Promise<ExtractionResult> => {
-  console.log("API key: ", apiKey);
   const response = await fetch(`${process.env.API_URL}/extract`, {
     method: "POST",
     body: JSON.stringify(body),
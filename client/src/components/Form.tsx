@@ -396,6 +396,12 @@ const FieldItem = memo(
               <SelectItem value="number">Number</SelectItem>
               <SelectItem value="link">Link</SelectItem>
               <SelectItem value="image">Image</SelectItem>
+              <SelectItem value="date">Date</SelectItem>
+              <SelectItem value="datetime">Date & time</SelectItem>
+              <SelectItem value="price">Price</SelectItem>
+              <SelectItem value="boolean">Yes / no</SelectItem>
+              <SelectItem value="email">Email</SelectItem>
+              <SelectItem value="phone">Phone</SelectItem>
             </SelectContent>
           </Select>
         </div>
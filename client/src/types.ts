@@ -1,4 +1,15 @@
-export type FieldType = "text" | "number" | "link" | "image";
+export type FieldType =
+  | "text"
+  | "number"
+  | "link"
+  | "image"
+  | "date"
+  | "datetime"
+  | "price"
+  | "boolean"
+  | "email"
+  | "phone"
+  | "enum";
 
 export type Field = {
   name: string;